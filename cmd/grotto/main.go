@@ -1,29 +1,361 @@
 package main
 
 import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
-	"github.com/eaneto/grotto/pkg/connection"
+	"github.com/eaneto/grotto/internal/splitter"
+	"github.com/eaneto/grotto/pkg/database"
 	"github.com/eaneto/grotto/pkg/processor"
 	_ "github.com/jackc/pgx/v4/stdlib"
+	"github.com/sirupsen/logrus"
 )
 
+// command A grotto subcommand, every command shares the connection
+// flags and maps to a method of the migration processor.
+type command struct {
+	description string
+	// Registers the flags specific to the command.
+	setup func(flags *flag.FlagSet, options *processor.Options)
+	run   func(migrationProcessor processor.MigrationProcessor) error
+}
+
+// PENDING_EXIT_CODE The exit code of a dry run with pending scripts.
+const PENDING_EXIT_CODE = 3
+
+// errPending A dry run found pending scripts, main exits with
+// PENDING_EXIT_CODE after closing the connection.
+var errPending = errors.New("there are pending scripts")
+
+// The flags of the migrate dry run.
+var dryRun, showSQL bool
+
+// INFO_FORMATS The output formats of the info command.
+var INFO_FORMATS = []string{"table", "json", "csv"}
+
+// The output format of the info command.
+var infoFormat = "table"
+
+var commands = map[string]command{
+	"migrate": {
+		description: "Executes all pending scripts",
+		setup: func(flags *flag.FlagSet, options *processor.Options) {
+			flags.BoolVar(&dryRun, "dry-run", false,
+				fmt.Sprintf("Only prints the pending scripts, exits with %d if there is any", PENDING_EXIT_CODE))
+			flags.BoolVar(&showSQL, "sql", false, "Prints every statement of the pending scripts on a dry run")
+			flags.BoolVar(&options.BaselineOnMigrate, "baseline-on-migrate", false,
+				"Baselines the migration table when the schema is not empty and the migration table doesn't exist")
+			baselineFlags(flags, options, "baseline-")
+			flags.BoolVar(&options.SkipValidation, "skip-validation", false,
+				"Skips the validation of the executed scripts, only meant for emergencies")
+			transactionModeFlag(flags, options)
+			flags.Func("target", "Executes only the versions up to the target: a version, latest (default) or current",
+				func(value string) error {
+					target, err := database.ParseTarget(value)
+					options.Target = target
+					return err
+				})
+		},
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			if dryRun {
+				return plan(migrationProcessor)
+			}
+			_, err := migrationProcessor.ProcessMigration()
+			return err
+		},
+	},
+	"undo": {
+		description: "Executes the undo scripts of the latest executed version",
+		setup: func(flags *flag.FlagSet, options *processor.Options) {
+			transactionModeFlag(flags, options)
+			flags.Func("target", "Undoes every executed version newer than the target version",
+				func(value string) error {
+					version, err := database.ParseVersion(value)
+					options.Target = database.Target{Version: version}
+					return err
+				})
+		},
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			undone, err := migrationProcessor.Undo()
+			printNames("Undone", undone)
+			return err
+		},
+	},
+	"info": {
+		description: "Prints the state of every script",
+		setup: func(flags *flag.FlagSet, options *processor.Options) {
+			flags.Func("format", "The output format: table (default), json or csv",
+				func(value string) error {
+					for _, format := range INFO_FORMATS {
+						if value == format {
+							infoFormat = value
+							return nil
+						}
+					}
+					return fmt.Errorf("invalid format %q, expected one of %s", value, strings.Join(INFO_FORMATS, ", "))
+				})
+		},
+		run: info,
+	},
+	"validate": {
+		description: "Fails if executed scripts were modified, are missing or unknown",
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			return migrationProcessor.Validate()
+		},
+	},
+	"baseline": {
+		description: "Marks the scripts up to a version as executed without executing them",
+		setup: func(flags *flag.FlagSet, options *processor.Options) {
+			baselineFlags(flags, options, "")
+		},
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			return migrationProcessor.Baseline()
+		},
+	},
+	"repair": {
+		description: "Removes failed scripts, realigns checksums and marks deleted scripts on the migration table",
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			changes, err := migrationProcessor.Repair()
+			for _, change := range changes {
+				if change.Detail != "" {
+					fmt.Printf("%s: %s (%s)\n", change.Action, change.ScriptName, change.Detail)
+				} else {
+					fmt.Printf("%s: %s\n", change.Action, change.ScriptName)
+				}
+			}
+			if err == nil && len(changes) == 0 {
+				fmt.Println("Nothing to repair.")
+			}
+			return err
+		},
+	},
+	"clean": {
+		description: "Drops all objects in the schemas, only when enabled",
+		setup: func(flags *flag.FlagSet, options *processor.Options) {
+			flags.BoolVar(&options.CleanEnabled, "clean-enabled", false,
+				"Allows the clean, never enable it for a production database")
+			flags.Func("schemas", "Comma separated schemas to clean (default the current schema)",
+				func(value string) error {
+					options.CleanSchemas = nil
+					for _, schema := range strings.Split(value, ",") {
+						schema = strings.TrimSpace(schema)
+						if schema == "" {
+							return fmt.Errorf("empty schema name in %q", value)
+						}
+						options.CleanSchemas = append(options.CleanSchemas, schema)
+					}
+					return nil
+				})
+		},
+		run: func(migrationProcessor processor.MigrationProcessor) error {
+			dropped, err := migrationProcessor.Clean()
+			printNames("Dropped", dropped)
+			return err
+		},
+	},
+}
+
+// commandOrder The order in which the commands are shown on the usage.
+var commandOrder = []string{"migrate", "undo", "info", "validate", "baseline", "repair", "clean"}
+
 func main() {
-	user := flag.String("user", "", "Database user's name")
-	password := flag.String("password", "", "Database user's password")
-	database := flag.String("database", "", "Name of the database")
-	address := flag.String("addresss", "localhost", "Database server address")
-	port := flag.String("port", "5432", "Database server port")
-	migrationDirectory := flag.String("dir", "", "The migration directory containing the scripts to be executed")
-
-	flag.Parse()
-
-	migrationProcessor := processor.New(connection.DatabaseInformation{
-		User:     *user,
-		Password: *password,
-		Database: *database,
-		Address:  *address,
-		Port:     *port,
-	}, *migrationDirectory)
-	migrationProcessor.ProcessMigration()
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "config" {
+		if len(os.Args) < 3 || os.Args[2] != "show" {
+			fmt.Fprintln(os.Stderr, "Usage: grotto config show [flags]")
+			os.Exit(2)
+		}
+		if err := showConfig(os.Args[3:]); err != nil {
+			logrus.Fatal("Error executing config show.\n", err)
+		}
+		return
+	}
+
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "-help" && name != "-h" && name != "help" {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s\n", name)
+		}
+		usage()
+		os.Exit(2)
+	}
+
+	known := configurableFlags()
+	settings := newSettings(name, cmd.setup)
+	err := settings.parse(os.Args[2:], known)
+	if err != nil {
+		logrus.Fatal(fmt.Sprintf("Error executing %s.\n", name), err)
+	}
+
+	var migrationProcessor processor.MigrationProcessorSQL
+	if *settings.databaseURL != "" {
+		migrationProcessor, err = processor.NewFromURL(context.Background(), *settings.databaseURL,
+			settings.directories, settings.options)
+	} else {
+		migrationProcessor, err = processor.New(context.Background(), settings.databaseInformation(),
+			settings.directories, settings.options)
+	}
+	if err != nil {
+		logrus.Fatal(fmt.Sprintf("Error executing %s.\n", name), err)
+	}
+
+	err = cmd.run(migrationProcessor)
+	migrationProcessor.Close()
+	if errors.Is(err, errPending) {
+		os.Exit(PENDING_EXIT_CODE)
+	}
+	if err != nil {
+		logrus.Fatal(fmt.Sprintf("Error executing %s.\n", name), err)
+	}
+}
+
+// transactionModeFlag Registers the flag with the transaction mode of
+// the commands that execute scripts.
+func transactionModeFlag(flags *flag.FlagSet, options *processor.Options) {
+	flags.Func("transaction-mode",
+		"How scripts are grouped in transactions: per-script (default), all or none",
+		func(value string) error {
+			mode, err := database.ParseTransactionMode(value)
+			options.TransactionMode = mode
+			return err
+		})
+}
+
+// baselineFlags Registers the flags with the version and the
+// description of the baseline marker, with the given prefix.
+func baselineFlags(flags *flag.FlagSet, options *processor.Options, prefix string) {
+	flags.Func(prefix+"version", "The version of the baseline, scripts up to it are considered executed (default 1)",
+		func(value string) error {
+			version, err := database.ParseVersion(value)
+			options.BaselineVersion = version
+			return err
+		})
+	flags.StringVar(&options.BaselineDescription, prefix+"description", processor.DEFAULT_BASELINE_DESCRIPTION,
+		"The description of the baseline")
+}
+
+// usage Prints all the available commands.
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: grotto <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].description)
+	}
+	fmt.Fprintf(os.Stderr, "  %-10s %s\n", "config", "Prints the resolved configuration with 'grotto config show'")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'grotto <command> -help' to see the flags of a command.")
+}
+
+// infoRow A script on the json and csv outputs of the info command.
+type infoRow struct {
+	Script          string `json:"script"`
+	Version         string `json:"version"`
+	Description     string `json:"description"`
+	Type            string `json:"type"`
+	State           string `json:"state"`
+	InstalledOn     string `json:"installed_on"`
+	ExecutionTimeMs int64  `json:"execution_time_ms"`
+}
+
+// info Prints the state of every script on the info format.
+func info(migrationProcessor processor.MigrationProcessor) error {
+	infos, err := migrationProcessor.Info()
+	if err != nil {
+		return err
+	}
+
+	rows := make([]infoRow, 0, len(infos))
+	for _, scriptInfo := range infos {
+		row := infoRow{
+			Script:          scriptInfo.Name,
+			Description:     scriptInfo.Description,
+			Type:            string(scriptInfo.Type),
+			State:           string(scriptInfo.State),
+			ExecutionTimeMs: scriptInfo.ExecutionTime.Milliseconds(),
+		}
+		if scriptInfo.Version != nil {
+			row.Version = scriptInfo.Version.String()
+		}
+		if !scriptInfo.InstalledOn.IsZero() {
+			row.InstalledOn = scriptInfo.InstalledOn.Format(time.RFC3339)
+		}
+		rows = append(rows, row)
+	}
+
+	switch infoFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "csv":
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"script", "version", "description", "type", "state", "installed_on", "execution_time_ms"})
+		for _, row := range rows {
+			writer.Write([]string{row.Script, row.Version, row.Description, row.Type, row.State,
+				row.InstalledOn, strconv.FormatInt(row.ExecutionTimeMs, 10)})
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VERSION\tDESCRIPTION\tTYPE\tINSTALLED ON\tSTATE\tEXECUTION TIME")
+	for i, row := range rows {
+		executionTime := ""
+		if !infos[i].InstalledOn.IsZero() {
+			executionTime = infos[i].ExecutionTime.String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\n", row.Version, row.Description, row.Type,
+			row.InstalledOn, row.State, executionTime)
+	}
+	return writer.Flush()
+}
+
+// plan Prints the scripts a migration would execute, with their
+// statements if requested, and returns errPending if there is any.
+func plan(migrationProcessor processor.MigrationProcessor) error {
+	pending, err := migrationProcessor.Plan()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		fmt.Println("No pending scripts.")
+		return nil
+	}
+
+	fmt.Printf("Pending scripts (%d):\n", len(pending))
+	for _, script := range pending {
+		fmt.Printf("  %s\n", script.Name)
+	}
+	if showSQL {
+		for _, script := range pending {
+			fmt.Printf("\n-- %s\n", script.Name)
+			for _, statement := range splitter.Split(script.Content) {
+				fmt.Printf("-- line %d\n%s;\n", statement.Line, statement.Content)
+			}
+		}
+	}
+	return errPending
+}
+
+// printNames Prints every name changed by a command.
+func printNames(action string, names []string) {
+	for _, name := range names {
+		fmt.Printf("%s: %s\n", action, name)
+	}
 }
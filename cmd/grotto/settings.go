@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/eaneto/grotto/internal/config"
+	"github.com/eaneto/grotto/pkg/connection"
+	"github.com/eaneto/grotto/pkg/processor"
+	"github.com/jackc/pgx/v4"
+)
+
+// settings The flags of a command, the flags not given on the command
+// line are read from the GROTTO_* environment variables and then from
+// the configuration file.
+type settings struct {
+	flags   *flag.FlagSet
+	options processor.Options
+
+	user         *string
+	password     *string
+	passwordFile *string
+	passwordCmd  *string
+	databaseName *string
+	address      *string
+	port         *string
+	databaseURL  *string
+	sslMode      *string
+	sslRootCert  *string
+	sslCert      *string
+	sslKey       *string
+	directories  []string
+	configFile   *string
+	environment  *string
+
+	// The configuration file read, empty if there is none.
+	file string
+	// Where the value of every flag came from.
+	sources map[string]config.Source
+	// The values of the environment variables and of the configuration
+	// file, by source.
+	layers []config.Layer
+}
+
+// newSettings Registers the flags shared by every command and the flags
+// of the command.
+func newSettings(name string, setup func(flags *flag.FlagSet, options *processor.Options)) *settings {
+	s := &settings{flags: flag.NewFlagSet(name, flag.ExitOnError)}
+	flags := s.flags
+	s.user = flags.String("user", "", "Database user's name (default PGUSER or the operating system user)")
+	s.password = flags.String("password", "", "Database user's password (default PGPASSWORD or ~/.pgpass)")
+	s.passwordFile = flags.String("password-file", "", "A file with the database user's password, like a mounted secret")
+	s.passwordCmd = flags.String("password-command", "",
+		"A command executed by the shell that prints the database user's password, like a token")
+	s.databaseName = flags.String("database", "", "Name of the database (default PGDATABASE or the user)")
+	s.address = flags.String("addresss", "", "Database server address (default PGHOST or localhost)")
+	s.port = flags.String("port", "", "Database server port (default PGPORT or 5432)")
+	s.sslMode = flags.String("sslmode", "", fmt.Sprintf("The TLS mode: %s (default PGSSLMODE or prefer)",
+		strings.Join(connection.SSL_MODES, ", ")))
+	s.sslRootCert = flags.String("sslrootcert", "", "The root certificate that signed the server certificate, on a PEM file")
+	s.sslCert = flags.String("sslcert", "", "The client certificate, on a PEM file")
+	s.sslKey = flags.String("sslkey", "", "The key of the client certificate, on a PEM file")
+	flags.Func("dir", "The migration directories containing the scripts to be executed, repeatable or comma separated, glob patterns are expanded",
+		func(value string) error {
+			for _, directory := range strings.Split(value, ",") {
+				if directory = strings.TrimSpace(directory); directory != "" {
+					s.directories = append(s.directories, directory)
+				}
+			}
+			return nil
+		})
+	s.databaseURL = flags.String("url", "", "Database connection URL or DSN, replaces the other connection flags")
+	flags.DurationVar(&s.options.LockTimeout, "lock-timeout", processor.DEFAULT_LOCK_TIMEOUT,
+		"How long to wait for another migration to release the migration lock")
+	flags.DurationVar(&s.options.ConnectTimeout, "connect-timeout", processor.DEFAULT_CONNECT_TIMEOUT,
+		"How long each attempt to connect to the database may take")
+	flags.IntVar(&s.options.ConnectRetries, "connect-retries", 0,
+		"How many times to retry connecting, with an exponential backoff, while the database doesn't accept connections")
+	s.configFile = flags.String("config", "",
+		fmt.Sprintf("The configuration file (default the first of %s found)", strings.Join(config.DEFAULT_FILES, ", ")))
+	s.environment = flags.String("env", "", "The environment of the configuration file, like dev or prod")
+	if setup != nil {
+		setup(flags, &s.options)
+	}
+	return s
+}
+
+// parse Parses the command line and fills the flags not given with the
+// GROTTO_* environment variables and then with the configuration file,
+// whose keys must be known flags.
+func (s *settings) parse(arguments []string, known map[string]bool) error {
+	s.flags.Parse(arguments)
+
+	names := []string{}
+	for name := range known {
+		names = append(names, name)
+	}
+	names = append(names, "config", "env")
+	environmentValues := config.FromEnvironment(names, os.LookupEnv)
+	s.layers = []config.Layer{{Source: config.SOURCE_ENV, Values: environmentValues}}
+
+	s.file = s.valueOf("config", *s.configFile, environmentValues)
+	environment := s.valueOf("env", *s.environment, environmentValues)
+	if s.file == "" {
+		s.file = config.Find(".")
+	}
+	if s.file == "" && environment != "" {
+		return fmt.Errorf("the environment %q needs a configuration file", environment)
+	}
+
+	if s.file != "" {
+		file, err := config.ReadFile(s.file)
+		if err != nil {
+			return err
+		}
+		fileValues, err := file.Environment(environment)
+		if err != nil {
+			return err
+		}
+		if err = fileValues.Check(known); err != nil {
+			return config.FileError{Path: s.file, Err: err}
+		}
+		s.layers = append(s.layers, config.Layer{Source: config.SOURCE_FILE, Values: fileValues})
+	}
+
+	var err error
+	s.sources, err = config.Resolve(s.flags, s.layers...)
+	if err != nil {
+		return err
+	}
+	s.choosePasswordSource()
+	return s.checkURL()
+}
+
+// checkURL Returns an error if a password file or command is given with
+// the URL, they would be ignored since the URL replaces the other
+// connection flags.
+func (s *settings) checkURL() error {
+	if *s.databaseURL == "" {
+		return nil
+	}
+	for _, name := range []string{"password-file", "password-command"} {
+		if s.flags.Lookup(name).Value.String() != "" {
+			return fmt.Errorf("%s can't be combined with url, the password must be on the URL", name)
+		}
+	}
+	return nil
+}
+
+// PASSWORD_FLAGS The flags with the password, only the one from the
+// source with the highest precedence is used.
+var PASSWORD_FLAGS = []string{"password", "password-file", "password-command"}
+
+// SOURCE_PRECEDENCE The sources of the flags, from the highest
+// precedence to the lowest.
+var SOURCE_PRECEDENCE = []config.Source{config.SOURCE_FLAG, config.SOURCE_ENV, config.SOURCE_FILE}
+
+// choosePasswordSource Clears the password flags set by a source with
+// lower precedence than another password flag, like a password on the
+// configuration file when -password-file is given. Password flags from
+// the same source are kept, so they're reported as a conflict.
+func (s *settings) choosePasswordSource() {
+	for _, source := range SOURCE_PRECEDENCE {
+		found := false
+		for _, name := range PASSWORD_FLAGS {
+			found = found || s.sources[name] == source
+		}
+		if !found {
+			continue
+		}
+		for _, name := range PASSWORD_FLAGS {
+			if s.sources[name] != source && s.sources[name] != config.SOURCE_DEFAULT {
+				s.flags.Set(name, "")
+				s.sources[name] = config.SOURCE_DEFAULT
+			}
+		}
+		return
+	}
+}
+
+// valueOf Returns the value of a flag given on the command line, or of
+// its environment variable.
+func (s *settings) valueOf(name string, value string, environmentValues config.Values) string {
+	given := false
+	s.flags.Visit(func(f *flag.Flag) {
+		given = given || f.Name == name
+	})
+	if !given && len(environmentValues[name]) > 0 {
+		return environmentValues[name][0]
+	}
+	return value
+}
+
+// databaseInformation Returns the connection fields of the flags.
+func (s *settings) databaseInformation() connection.DatabaseInformation {
+	return connection.DatabaseInformation{
+		User:     *s.user,
+		Password: *s.password,
+		Database: *s.databaseName,
+		Address:  *s.address,
+		Port:     *s.port,
+
+		PasswordFile:    *s.passwordFile,
+		PasswordCommand: *s.passwordCmd,
+
+		SSLMode:     *s.sslMode,
+		SSLRootCert: *s.sslRootCert,
+		SSLCert:     *s.sslCert,
+		SSLKey:      *s.sslKey,
+	}
+}
+
+// configurableFlags Returns the flags of every command, the keys
+// allowed on the configuration file. It must be called before the flags
+// of the command are registered, since registering a flag resets its
+// variable.
+func configurableFlags() map[string]bool {
+	known := map[string]bool{}
+	for name, cmd := range commands {
+		newSettings(name, cmd.setup).flags.VisitAll(func(f *flag.Flag) {
+			known[f.Name] = true
+		})
+	}
+	delete(known, "config")
+	delete(known, "env")
+	return known
+}
+
+// showConfig Prints the resolved value of the shared flags and of every
+// other flag set on the environment variables or on the configuration
+// file, with the secrets masked, and the connection resolved with the
+// PG* environment variables, the service file and the password file.
+func showConfig(arguments []string) error {
+	known := configurableFlags()
+	s := newSettings("config show", nil)
+	if err := s.parse(arguments, known); err != nil {
+		return err
+	}
+
+	if s.file != "" {
+		fmt.Printf("Configuration file: %s\n", s.file)
+	}
+	if *s.environment != "" {
+		fmt.Printf("Environment: %s\n", *s.environment)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "FLAG\tVALUE\tSOURCE")
+	s.flags.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "env" {
+			return
+		}
+		value := f.Value.String()
+		if f.Name == "dir" {
+			value = strings.Join(s.directories, ",")
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", f.Name, config.Mask(f.Name, value), s.sources[f.Name])
+	})
+
+	others := config.Values{}
+	sources := map[string]config.Source{}
+	for _, layer := range s.layers {
+		for name, values := range layer.Values {
+			_, seen := others[name]
+			if s.flags.Lookup(name) == nil && !seen {
+				others[name] = values
+				sources[name] = layer.Source
+			}
+		}
+	}
+	names := make([]string, 0, len(others))
+	for name := range others {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(others[name], ",")
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", name, config.Mask(name, value), sources[name])
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	connectionString := *s.databaseURL
+	if connectionString == "" {
+		connectionString = s.databaseInformation().URL()
+	}
+	connectionConfig, err := pgx.ParseConfig(connectionString)
+	if err != nil {
+		return err
+	}
+	// The password command isn't executed to show the configuration.
+	password := "none"
+	switch {
+	case *s.passwordFile != "":
+		password = "from password-file"
+	case *s.passwordCmd != "":
+		password = "from password-command"
+	case connectionConfig.Password != "":
+		password = config.MASK
+	}
+	fmt.Printf("\nConnection: host=%s port=%d user=%s database=%s password=%s\n", connectionConfig.Host,
+		connectionConfig.Port, connectionConfig.User, connectionConfig.Database, password)
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eaneto/grotto/internal/config"
+	"github.com/eaneto/grotto/pkg/connection"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "grotto.yaml")
+	os.WriteFile(path, []byte(content), 0600)
+	return path
+}
+
+func parseSettings(t *testing.T, arguments ...string) (*settings, error) {
+	known := configurableFlags()
+	s := newSettings("migrate", commands["migrate"].setup)
+	return s, s.parse(arguments, known)
+}
+
+func TestPasswordFileFlagShouldReplaceThePasswordFromEnvironmentAndFile(t *testing.T) {
+	t.Setenv("GROTTO_PASSWORD", "env_secret")
+	path := writeConfig(t, "password-command: echo file_secret\n")
+
+	s, err := parseSettings(t, "-config", path, "-password-file", "/run/secrets/db_password")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "", *s.password)
+	assert.Equal(t, "/run/secrets/db_password", *s.passwordFile)
+	assert.Equal(t, "", *s.passwordCmd)
+	assert.Equal(t, config.SOURCE_FLAG, s.sources["password-file"])
+	assert.Equal(t, config.SOURCE_DEFAULT, s.sources["password"])
+	assert.Equal(t, config.SOURCE_DEFAULT, s.sources["password-command"])
+}
+
+func TestPasswordFromEnvironmentShouldReplaceThePasswordFileFromFile(t *testing.T) {
+	t.Setenv("GROTTO_PASSWORD", "env_secret")
+	path := writeConfig(t, "password-file: /run/secrets/db_password\n")
+
+	s, err := parseSettings(t, "-config", path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "env_secret", *s.password)
+	assert.Equal(t, "", *s.passwordFile)
+	assert.Equal(t, config.SOURCE_ENV, s.sources["password"])
+}
+
+func TestPasswordCommandFromFileShouldBeUsedWithoutOtherPassword(t *testing.T) {
+	path := writeConfig(t, "password-command: echo file_secret\n")
+
+	s, err := parseSettings(t, "-config", path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "echo file_secret", *s.passwordCmd)
+	assert.Equal(t, config.SOURCE_FILE, s.sources["password-command"])
+}
+
+func TestPasswordsFromTheSameSourceShouldBeKeptAsAConflict(t *testing.T) {
+	t.Setenv("GROTTO_PASSWORD", "env_secret")
+	path := writeConfig(t, "password: file_secret\n")
+
+	s, err := parseSettings(t, "-config", path, "-password", "secret", "-password-file", "/run/secrets/db_password")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", *s.password)
+	assert.Equal(t, "/run/secrets/db_password", *s.passwordFile)
+	assert.Equal(t, config.SOURCE_FLAG, s.sources["password"])
+	assert.Equal(t, config.SOURCE_FLAG, s.sources["password-file"])
+
+	_, err = s.databaseInformation().ResolvePassword(context.Background())
+
+	var passwordError connection.PasswordError
+	assert.ErrorAs(t, err, &passwordError)
+	assert.Equal(t, "password and password-file", passwordError.Setting)
+}
+
+func TestPasswordFileWithURLShouldReturnError(t *testing.T) {
+	path := writeConfig(t, "password-file: /run/secrets/db_password\n")
+
+	_, err := parseSettings(t, "-config", path, "-url", "postgres://app@db:5432/app")
+
+	assert.ErrorContains(t, err, "password-file can't be combined with url")
+}
@@ -0,0 +1,130 @@
+package cleaner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eaneto/grotto/internal/session"
+	"github.com/sirupsen/logrus"
+)
+
+// CURRENT_SCHEMA_QUERY Returns the current schema, cleaned when no
+// schema is configured.
+const CURRENT_SCHEMA_QUERY = "SELECT current_schema()"
+
+// LIST_OBJECTS_QUERY Lists the views, tables, sequences, functions and
+// types of a schema, with the kind used on the drop statement and the
+// quoted name, in the order they should be dropped. Objects created by
+// extensions are left to the extensions, and objects created along with
+// another one, like the multirange of a range type, are dropped with it.
+const LIST_OBJECTS_QUERY = `SELECT kind, name FROM (
+	SELECT CASE c.relkind WHEN 'm' THEN 1 WHEN 'v' THEN 2 WHEN 'S' THEN 4 ELSE 3 END AS position,
+		CASE c.relkind WHEN 'm' THEN 'materialized view' WHEN 'v' THEN 'view' WHEN 'S' THEN 'sequence'
+		ELSE 'table' END AS kind,
+		format('%I.%I', n.nspname, c.relname) AS name
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE n.nspname = $1 AND c.relkind IN ('m', 'v', 'r', 'p', 'S') AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype IN ('e', 'i'))
+	UNION ALL
+	SELECT 5, CASE p.prokind WHEN 'a' THEN 'aggregate' WHEN 'p' THEN 'procedure' ELSE 'function' END,
+		format('%I.%I(%s)', n.nspname, p.proname, pg_get_function_identity_arguments(p.oid))
+	FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+	WHERE n.nspname = $1 AND NOT EXISTS (
+		SELECT 1 FROM pg_depend d WHERE d.objid = p.oid AND d.deptype IN ('e', 'i'))
+	UNION ALL
+	SELECT 6, CASE t.typtype WHEN 'd' THEN 'domain' ELSE 'type' END, format('%I.%I', n.nspname, t.typname)
+	FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace
+	WHERE n.nspname = $1 AND t.typcategory <> 'A'
+	AND (t.typtype IN ('e', 'd', 'r') OR
+		(t.typtype = 'c' AND (SELECT c.relkind FROM pg_class c WHERE c.oid = t.typrelid) = 'c'))
+	AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = t.oid AND d.deptype IN ('e', 'i'))
+) AS objects ORDER BY position, name`
+
+// SchemaCleaner Basic interface for the schema cleaner.
+type SchemaCleaner interface {
+	Clean() ([]string, error)
+}
+
+// SchemaCleanerSQL Schema cleaner for SQL.
+type SchemaCleanerSQL struct {
+	// Transaction or session in which the objects should be dropped.
+	Tx session.Queryer
+	// The schemas to clean, the current schema if empty.
+	Schemas []string
+}
+
+// object A database object to be dropped.
+type object struct {
+	// The kind of the object on the drop statement, like table.
+	kind string
+	// The quoted name of the object, qualified by its schema.
+	name string
+}
+
+// Clean Drops every view, table, sequence, function and type in the
+// schemas, including the migration table, and returns the kind and the
+// name of the dropped objects.
+func (c SchemaCleanerSQL) Clean() ([]string, error) {
+	schemas, err := c.schemas()
+	if err != nil {
+		return nil, err
+	}
+
+	dropped := []string{}
+	for _, schema := range schemas {
+		objects, err := c.listObjects(schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			// Dropping an object cascades to the objects depending on it,
+			// those are already gone when their turn comes.
+			_, err = c.Tx.Exec(fmt.Sprintf("DROP %s IF EXISTS %s CASCADE", strings.ToUpper(object.kind), object.name))
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"kind": object.kind,
+					"name": object.name,
+				}).Error("Error dropping object.\n", err)
+				return nil, err
+			}
+			dropped = append(dropped, object.kind+" "+object.name)
+		}
+	}
+	return dropped, nil
+}
+
+// schemas Returns the configured schemas or the current schema.
+func (c SchemaCleanerSQL) schemas() ([]string, error) {
+	if len(c.Schemas) > 0 {
+		return c.Schemas, nil
+	}
+	var schema string
+	err := c.Tx.QueryRow(CURRENT_SCHEMA_QUERY).Scan(&schema)
+	if err != nil {
+		logrus.Error("Error reading the current schema.\n", err)
+		return nil, err
+	}
+	return []string{schema}, nil
+}
+
+// listObjects Lists every object to be dropped in the schema.
+func (c SchemaCleanerSQL) listObjects(schema string) ([]object, error) {
+	rows, err := c.Tx.Query(LIST_OBJECTS_QUERY, schema)
+	if err != nil {
+		logrus.WithField("schema", schema).Error("Error listing objects.\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	objects := []object{}
+	for rows.Next() {
+		var object object
+		err = rows.Scan(&object.kind, &object.name)
+		if err != nil {
+			logrus.WithField("schema", schema).Error("Error reading objects.\n", err)
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
@@ -0,0 +1,175 @@
+package cleaner
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanWithNilTransactionShouldPanic(t *testing.T) {
+	cleaner := SchemaCleanerSQL{
+		Tx: nil,
+	}
+
+	assert.Panics(t, func() {
+		cleaner.Clean()
+	})
+}
+
+func TestCleanShouldDropEveryObjectOnTheCurrentSchema(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	cleaner := SchemaCleanerSQL{Tx: tx}
+	mock.ExpectQuery(regexp.QuoteMeta(CURRENT_SCHEMA_QUERY)).
+		WillReturnRows(sqlmock.NewRows([]string{"current_schema"}).AddRow("public"))
+	mock.ExpectQuery("pg_class").
+		WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).
+			AddRow("view", "public.active_users").
+			AddRow("table", "public.grotto_migration").
+			AddRow("table", "public.users").
+			AddRow("sequence", "public.ids").
+			AddRow("function", "public.add(integer, integer)").
+			AddRow("type", "public.mood"))
+	for _, statement := range []string{
+		"DROP VIEW IF EXISTS public.active_users CASCADE",
+		"DROP TABLE IF EXISTS public.grotto_migration CASCADE",
+		"DROP TABLE IF EXISTS public.users CASCADE",
+		"DROP SEQUENCE IF EXISTS public.ids CASCADE",
+		"DROP FUNCTION IF EXISTS public.add(integer, integer) CASCADE",
+		"DROP TYPE IF EXISTS public.mood CASCADE",
+	} {
+		mock.ExpectExec(regexp.QuoteMeta(statement)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	dropped, err := cleaner.Clean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"view public.active_users",
+		"table public.grotto_migration",
+		"table public.users",
+		"sequence public.ids",
+		"function public.add(integer, integer)",
+		"type public.mood",
+	}, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCleanWithSchemasShouldDropTheObjectsOfEverySchema(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	cleaner := SchemaCleanerSQL{Tx: tx, Schemas: []string{"app", "audit"}}
+	mock.ExpectQuery("pg_class").
+		WithArgs("app").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).AddRow("table", "app.users"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS app.users CASCADE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("pg_class").
+		WithArgs("audit").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).AddRow("domain", "audit.email"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP DOMAIN IF EXISTS audit.email CASCADE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := cleaner.Clean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"table app.users", "domain audit.email"}, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCleanWithRangeTypeShouldDropOnlyTheRangeType(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	cleaner := SchemaCleanerSQL{Tx: tx, Schemas: []string{"public"}}
+	// The multirange of the range type depends on it, so it's dropped
+	// with the range type and isn't listed.
+	mock.ExpectQuery(regexp.QuoteMeta("t.typtype IN ('e', 'd', 'r')") + ".*" +
+		regexp.QuoteMeta("d.objid = t.oid AND d.deptype IN ('e', 'i')")).
+		WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).AddRow("type", "public.floatrange"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TYPE IF EXISTS public.floatrange CASCADE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := cleaner.Clean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"type public.floatrange"}, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCleanWithExtensionTableShouldKeepIt(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	cleaner := SchemaCleanerSQL{Tx: tx, Schemas: []string{"public"}}
+	// The tables and views of an extension, like spatial_ref_sys of
+	// postgis, can only be dropped with the extension, so they aren't
+	// listed.
+	mock.ExpectQuery(regexp.QuoteMeta("d.objid = c.oid AND d.deptype IN ('e', 'i')")).
+		WithArgs("public").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).AddRow("table", "public.places"))
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE IF EXISTS public.places CASCADE")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	dropped, err := cleaner.Clean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"table public.places"}, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCleanWithErrorDroppingObjectShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	cleaner := SchemaCleanerSQL{Tx: tx, Schemas: []string{"public"}}
+	expectedError := errors.New("Error dropping table")
+	mock.ExpectQuery("pg_class").
+		WillReturnRows(sqlmock.NewRows([]string{"kind", "name"}).AddRow("table", "public.users"))
+	mock.ExpectExec("DROP TABLE").WillReturnError(expectedError)
+
+	dropped, actualError := cleaner.Clean()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.Nil(t, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCleanWithErrorReadingTheCurrentSchemaShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	cleaner := SchemaCleanerSQL{Tx: db}
+	expectedError := errors.New("connection closed")
+	mock.ExpectQuery(regexp.QuoteMeta(CURRENT_SCHEMA_QUERY)).WillReturnError(expectedError)
+
+	dropped, actualError := cleaner.Clean()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.Nil(t, dropped)
+	assertDatabaseExpectations(t, mock)
+}
+
+func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectation were met: %s", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package config reads the values of the flags from a grotto.yaml or
+// grotto.toml configuration file, with named environments, and from
+// GROTTO_* environment variables.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DEFAULT_FILES The configuration files looked up on the working
+// directory when no configuration file is given.
+var DEFAULT_FILES = []string{"grotto.yaml", "grotto.yml", "grotto.toml"}
+
+// ENVIRONMENTS_KEY The key of the environments on the configuration
+// file.
+const ENVIRONMENTS_KEY = "environments"
+
+// ENV_PREFIX The prefix of the environment variables with the value of
+// a flag, like GROTTO_LOCK_TIMEOUT for -lock-timeout.
+const ENV_PREFIX = "GROTTO_"
+
+// ENV_ALIASES Other environment variables with the value of a flag,
+// read when the variable named after the flag isn't set.
+var ENV_ALIASES = map[string]string{"addresss": "GROTTO_HOST"}
+
+// SECRET_FLAGS The flags masked when the configuration is shown.
+var SECRET_FLAGS = []string{"password"}
+
+// MASK The value shown instead of a secret.
+const MASK = "********"
+
+// Source Where the value of a flag came from.
+type Source string
+
+const (
+	SOURCE_FLAG    Source = "flag"
+	SOURCE_ENV     Source = "env"
+	SOURCE_FILE    Source = "file"
+	SOURCE_DEFAULT Source = "default"
+)
+
+// Values The values of the flags, by flag name. A flag can have
+// several values, like the migration directories.
+type Values map[string][]string
+
+// Layer The values of the flags from a single source.
+type Layer struct {
+	Source Source
+	Values Values
+}
+
+// File The values of a configuration file, the top level values are
+// shared by every environment.
+type File struct {
+	Values       Values
+	Environments map[string]Values
+}
+
+// FileError The configuration file couldn't be read or parsed.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("error reading configuration file %s: %s", e.Path, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownEnvironmentError The selected environment isn't on the
+// configuration file.
+type UnknownEnvironmentError struct {
+	Name         string
+	Environments []string
+}
+
+func (e UnknownEnvironmentError) Error() string {
+	if len(e.Environments) == 0 {
+		return fmt.Sprintf("unknown environment %q, the configuration file has no environments", e.Name)
+	}
+	return fmt.Sprintf("unknown environment %q, expected one of %s", e.Name, strings.Join(e.Environments, ", "))
+}
+
+// UnknownKeyError A key of the configuration file isn't a flag of any
+// command.
+type UnknownKeyError struct {
+	Key string
+}
+
+func (e UnknownKeyError) Error() string {
+	return fmt.Sprintf("unknown configuration key %q", e.Key)
+}
+
+// Find Returns the first of the DEFAULT_FILES found on the directory,
+// empty if there is none.
+func Find(directory string) string {
+	for _, name := range DEFAULT_FILES {
+		path := filepath.Join(directory, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// ReadFile Reads a yaml or a toml configuration file, the format is
+// chosen by the extension of the file.
+func ReadFile(path string) (File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, FileError{Path: path, Err: err}
+	}
+
+	var file File
+	switch extension := filepath.Ext(path); extension {
+	case ".yaml", ".yml":
+		file, err = parseYAML(data)
+	case ".toml":
+		file, err = parseTOML(data)
+	default:
+		err = fmt.Errorf("unknown format %q, expected .yaml, .yml or .toml", extension)
+	}
+	if err != nil {
+		return File{}, FileError{Path: path, Err: err}
+	}
+	return file, nil
+}
+
+// newFile Splits the keys of a parsed configuration file between the
+// top level values and the environments.
+func newFile(tree map[string]interface{}) (File, error) {
+	file := File{Values: Values{}, Environments: map[string]Values{}}
+	for key, value := range tree {
+		if key != ENVIRONMENTS_KEY {
+			values, ok := value.([]string)
+			if !ok {
+				return File{}, fmt.Errorf("key %q must be a value or a list of values", key)
+			}
+			file.Values[key] = values
+			continue
+		}
+
+		environments, ok := value.(map[string]interface{})
+		if !ok {
+			return File{}, fmt.Errorf("key %q must map the environment names to their values", key)
+		}
+		for name, environment := range environments {
+			keys, ok := environment.(map[string]interface{})
+			if !ok {
+				return File{}, fmt.Errorf("environment %q must map keys to values", name)
+			}
+			file.Environments[name] = Values{}
+			for key, value := range keys {
+				values, ok := value.([]string)
+				if !ok {
+					return File{}, fmt.Errorf("key %q of environment %q must be a value or a list of values", key, name)
+				}
+				file.Environments[name][key] = values
+			}
+		}
+	}
+	return file, nil
+}
+
+// Environment Returns the top level values of the file overridden by
+// the values of the environment, only the top level values if the
+// environment is empty.
+func (f File) Environment(name string) (Values, error) {
+	values := Values{}
+	for key, value := range f.Values {
+		values[key] = value
+	}
+	if name == "" {
+		return values, nil
+	}
+
+	environment, ok := f.Environments[name]
+	if !ok {
+		names := make([]string, 0, len(f.Environments))
+		for environmentName := range f.Environments {
+			names = append(names, environmentName)
+		}
+		sort.Strings(names)
+		return nil, UnknownEnvironmentError{Name: name, Environments: names}
+	}
+	for key, value := range environment {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// Check Returns an UnknownKeyError if any key isn't one of the known
+// flags.
+func (v Values) Check(known map[string]bool) error {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !known[key] {
+			return UnknownKeyError{Key: key}
+		}
+	}
+	return nil
+}
+
+// EnvironmentVariable Returns the name of the environment variable with
+// the value of a flag, like GROTTO_LOCK_TIMEOUT for lock-timeout.
+func EnvironmentVariable(flagName string) string {
+	return ENV_PREFIX + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// FromEnvironment Returns the values of the flags set on their
+// environment variables or on their ENV_ALIASES, an empty variable is
+// ignored.
+func FromEnvironment(flagNames []string, lookup func(string) (string, bool)) Values {
+	values := Values{}
+	for _, name := range flagNames {
+		value, _ := lookup(EnvironmentVariable(name))
+		if alias, ok := ENV_ALIASES[name]; ok && value == "" {
+			value, _ = lookup(alias)
+		}
+		if value != "" {
+			values[name] = []string{value}
+		}
+	}
+	return values
+}
+
+// Resolve Sets every flag that wasn't given on the command line with
+// the values of the first layer that has it, and returns where the
+// value of every flag came from.
+func Resolve(flags *flag.FlagSet, layers ...Layer) (map[string]Source, error) {
+	sources := map[string]Source{}
+	flags.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = SOURCE_DEFAULT
+	})
+	flags.Visit(func(f *flag.Flag) {
+		sources[f.Name] = SOURCE_FLAG
+	})
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] == SOURCE_FLAG {
+			return
+		}
+		for _, layer := range layers {
+			values, ok := layer.Values[f.Name]
+			if !ok {
+				continue
+			}
+			for _, value := range values {
+				if setErr := flags.Set(f.Name, value); setErr != nil {
+					err = fmt.Errorf("invalid value %q for %s from %s: %w", value, f.Name, layer.Source, setErr)
+					return
+				}
+			}
+			sources[f.Name] = layer.Source
+			return
+		}
+	})
+	return sources, err
+}
+
+// dsnPassword The password of a key/value connection string.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Mask Returns the value of a flag to be shown, with secrets and the
+// password of connection URLs masked.
+func Mask(flagName string, value string) string {
+	for _, secret := range SECRET_FLAGS {
+		if flagName == secret && value != "" {
+			return MASK
+		}
+	}
+	if flagName != "url" {
+		return value
+	}
+
+	databaseURL, err := url.Parse(value)
+	if err != nil || databaseURL.Scheme == "" {
+		return dsnPassword.ReplaceAllString(value, "${1}"+MASK)
+	}
+	// The mask would be escaped on the URL, it's replaced afterwards.
+	if _, ok := databaseURL.User.Password(); ok {
+		databaseURL.User = url.UserPassword(databaseURL.User.Username(), "mask")
+	}
+	query := databaseURL.Query()
+	if _, ok := query["password"]; ok {
+		query.Set("password", "mask")
+		databaseURL.RawQuery = query.Encode()
+	}
+	masked := strings.Replace(databaseURL.String(), ":mask@", ":"+MASK+"@", 1)
+	return strings.Replace(masked, "password=mask", "password="+MASK, 1)
+}
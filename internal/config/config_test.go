@@ -0,0 +1,190 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const YAML_CONFIG = `
+user: postgres
+password: secret
+port: 5432
+dir:
+  - core
+  - modules/*/migrations
+environments:
+  dev:
+    database: app_dev
+    clean-enabled: true
+  prod:
+    database: app
+    target: 1.10
+`
+
+const TOML_CONFIG = `
+# Shared by every environment
+user = "postgres"
+password = 'secret'
+port = 5432
+dir = [
+  "core",
+  "modules/*/migrations", # modules
+]
+
+[environments.dev]
+database = "app_dev"
+clean-enabled = true
+
+[environments.prod]
+database = "app"
+target = "1.10"
+`
+
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	os.WriteFile(path, []byte(content), 0600)
+	return path
+}
+
+func TestReadYAMLFileShouldReadTheValuesAndTheEnvironments(t *testing.T) {
+	file, err := ReadFile(writeConfig(t, "grotto.yaml", YAML_CONFIG))
+
+	assert.Nil(t, err)
+	assert.Equal(t, Values{
+		"user":     {"postgres"},
+		"password": {"secret"},
+		"port":     {"5432"},
+		"dir":      {"core", "modules/*/migrations"},
+	}, file.Values)
+	assert.Equal(t, Values{"database": {"app_dev"}, "clean-enabled": {"true"}}, file.Environments["dev"])
+	assert.Equal(t, Values{"database": {"app"}, "target": {"1.10"}}, file.Environments["prod"])
+}
+
+func TestReadTOMLFileShouldReadLikeTheYAMLFile(t *testing.T) {
+	yamlFile, err := ReadFile(writeConfig(t, "grotto.yaml", YAML_CONFIG))
+	assert.Nil(t, err)
+
+	tomlFile, err := ReadFile(writeConfig(t, "grotto.toml", TOML_CONFIG))
+
+	assert.Nil(t, err)
+	assert.Equal(t, yamlFile, tomlFile)
+}
+
+func TestReadTOMLFileWithUnquotedStringShouldReturnFileError(t *testing.T) {
+	path := writeConfig(t, "grotto.toml", "user = \"postgres\"\ndatabase = app db\n")
+
+	_, err := ReadFile(path)
+
+	var fileError FileError
+	assert.ErrorAs(t, err, &fileError)
+	assert.Equal(t, path, fileError.Path)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestReadFileWithUnknownFormatShouldReturnFileError(t *testing.T) {
+	_, err := ReadFile(writeConfig(t, "grotto.json", "{}"))
+
+	var fileError FileError
+	assert.ErrorAs(t, err, &fileError)
+}
+
+func TestEnvironmentShouldOverrideTheTopLevelValues(t *testing.T) {
+	file := File{
+		Values:       Values{"user": {"postgres"}, "database": {"app"}},
+		Environments: map[string]Values{"dev": {"database": {"app_dev"}}},
+	}
+
+	values, err := file.Environment("dev")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Values{"user": {"postgres"}, "database": {"app_dev"}}, values)
+	assert.Equal(t, Values{"user": {"postgres"}, "database": {"app"}}, file.Values)
+}
+
+func TestUnknownEnvironmentShouldReturnUnknownEnvironmentError(t *testing.T) {
+	file := File{Environments: map[string]Values{"prod": {}, "dev": {}}}
+
+	_, err := file.Environment("qa")
+
+	assert.Equal(t, UnknownEnvironmentError{Name: "qa", Environments: []string{"dev", "prod"}}, err)
+}
+
+func TestCheckWithUnknownKeyShouldReturnUnknownKeyError(t *testing.T) {
+	values := Values{"user": {"postgres"}, "passwrd": {"secret"}}
+
+	err := values.Check(map[string]bool{"user": true, "password": true})
+
+	assert.Equal(t, UnknownKeyError{Key: "passwrd"}, err)
+}
+
+func TestFromEnvironmentShouldReadTheGrottoVariables(t *testing.T) {
+	variables := map[string]string{
+		"GROTTO_LOCK_TIMEOUT": "1m",
+		"GROTTO_USER":         "",
+		"GROTTO_HOST":         "db.internal",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := variables[name]
+		return value, ok
+	}
+
+	values := FromEnvironment([]string{"lock-timeout", "user", "database", "addresss"}, lookup)
+
+	assert.Equal(t, Values{"lock-timeout": {"1m"}, "addresss": {"db.internal"}}, values)
+}
+
+func TestResolveShouldPreferFlagsThenEnvironmentThenFile(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	user := flags.String("user", "", "")
+	database := flags.String("database", "", "")
+	port := flags.String("port", "5432", "")
+	lockTimeout := flags.Duration("lock-timeout", time.Minute, "")
+	address := flags.String("addresss", "localhost", "")
+	flags.Parse([]string{"-user", "flag_user"})
+
+	sources, err := Resolve(flags,
+		Layer{Source: SOURCE_ENV, Values: Values{"user": {"env_user"}, "database": {"env_db"}}},
+		Layer{Source: SOURCE_FILE, Values: Values{"user": {"file_user"}, "database": {"file_db"}, "port": {"6543"}}},
+	)
+
+	assert.Nil(t, err)
+	assert.Equal(t, "flag_user", *user)
+	assert.Equal(t, "env_db", *database)
+	assert.Equal(t, "6543", *port)
+	assert.Equal(t, time.Minute, *lockTimeout)
+	assert.Equal(t, "localhost", *address)
+	assert.Equal(t, map[string]Source{
+		"user":         SOURCE_FLAG,
+		"database":     SOURCE_ENV,
+		"port":         SOURCE_FILE,
+		"lock-timeout": SOURCE_DEFAULT,
+		"addresss":     SOURCE_DEFAULT,
+	}, sources)
+}
+
+func TestResolveWithInvalidValueShouldReturnError(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Duration("lock-timeout", time.Minute, "")
+	flags.Parse([]string{})
+
+	_, err := Resolve(flags, Layer{Source: SOURCE_FILE, Values: Values{"lock-timeout": {"forever"}}})
+
+	assert.ErrorContains(t, err, "lock-timeout from file")
+}
+
+func TestMaskShouldHideSecrets(t *testing.T) {
+	assert.Equal(t, MASK, Mask("password", "secret"))
+	assert.Equal(t, "", Mask("password", ""))
+	assert.Equal(t, "postgres", Mask("user", "postgres"))
+	assert.Equal(t, "postgres://app:"+MASK+"@db:5432/app?sslmode=require",
+		Mask("url", "postgres://app:s3cret@db:5432/app?sslmode=require"))
+	assert.Equal(t, "postgres://app@db:5432/app", Mask("url", "postgres://app@db:5432/app"))
+	assert.Equal(t, "postgres:///?password="+MASK, Mask("url", "postgres:///?password=s3cret"))
+	assert.Equal(t, "host=db password="+MASK+" dbname=app", Mask("url", "host=db password=s3cret dbname=app"))
+	assert.Equal(t, "host=db password="+MASK+" dbname=app", Mask("url", "host=db password='s3 cret' dbname=app"))
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML Parses a toml configuration file. Versions like 1.10 must be
+// quoted, a number is read as a float and written back as 1.1.
+func parseTOML(data []byte) (File, error) {
+	var document map[string]interface{}
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return File{}, err
+	}
+
+	tree, err := tomlTable(document)
+	if err != nil {
+		return File{}, err
+	}
+	return newFile(tree)
+}
+
+// tomlTable Converts a toml table to a tree of the values of every key,
+// a value is a list of strings or another table.
+func tomlTable(table map[string]interface{}) (map[string]interface{}, error) {
+	tree := map[string]interface{}{}
+	for key, value := range table {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			subtree, err := tomlTable(value)
+			if err != nil {
+				return nil, err
+			}
+			tree[key] = subtree
+		case []interface{}:
+			values := make([]string, 0, len(value))
+			for _, item := range value {
+				itemValue, ok := tomlValue(item)
+				if !ok {
+					return nil, fmt.Errorf("the list of %q must only have values", key)
+				}
+				values = append(values, itemValue)
+			}
+			tree[key] = values
+		default:
+			scalar, ok := tomlValue(value)
+			if !ok {
+				return nil, fmt.Errorf("unsupported value for %q", key)
+			}
+			tree[key] = []string{scalar}
+		}
+	}
+	return tree, nil
+}
+
+// tomlValue Returns a string, number or boolean as it's given to a flag,
+// false if the value is of another type.
+func tomlValue(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case int64:
+		return strconv.FormatInt(value, 10), true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	default:
+		return "", false
+	}
+}
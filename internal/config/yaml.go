@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML Parses a yaml configuration file, the scalars are kept as
+// they were written so versions like 1.10 aren't read as numbers.
+func parseYAML(data []byte) (File, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return File{}, err
+	}
+	if len(document.Content) == 0 {
+		return newFile(map[string]interface{}{})
+	}
+
+	tree, err := yamlMapping(document.Content[0])
+	if err != nil {
+		return File{}, err
+	}
+	return newFile(tree)
+}
+
+// yamlMapping Converts a yaml mapping to a tree of the values of every
+// key, a value is a list of strings or another mapping. Null values are
+// ignored.
+func yamlMapping(node *yaml.Node) (map[string]interface{}, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+
+	tree := map[string]interface{}{}
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key, value := node.Content[index], node.Content[index+1]
+		if _, ok := tree[key.Value]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", key.Line, key.Value)
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			if value.Tag != "!!null" {
+				tree[key.Value] = []string{value.Value}
+			}
+		case yaml.SequenceNode:
+			values := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return nil, fmt.Errorf("line %d: the list of %q must only have values", item.Line, key.Value)
+				}
+				values = append(values, item.Value)
+			}
+			tree[key.Value] = values
+		case yaml.MappingNode:
+			mapping, err := yamlMapping(value)
+			if err != nil {
+				return nil, err
+			}
+			tree[key.Value] = mapping
+		default:
+			return nil, fmt.Errorf("line %d: unsupported value for %q", value.Line, key.Value)
+		}
+	}
+	return tree, nil
+}
@@ -1,11 +1,12 @@
 package executor
 
 import (
-	"database/sql"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/eaneto/grotto/internal/registry"
+	"github.com/eaneto/grotto/internal/session"
+	"github.com/eaneto/grotto/internal/splitter"
 	"github.com/eaneto/grotto/pkg/database"
 	"github.com/sirupsen/logrus"
 )
@@ -13,38 +14,168 @@ import (
 // ScriptExecutor Basic interface for the script executor.
 type ScriptExecutor interface {
 	CreateMigrationTable() error
-	ProcessScripts(scripts []database.SQLScript) error
-	RollbackTransaction()
-	CommitTransaction()
+	ProcessScripts(scripts []database.SQLScript) ([]database.MigrationRecord, error)
+	UndoScripts(scripts []database.SQLScript) error
+	BeginTransaction() error
+	RollbackTransaction() error
+	CommitTransaction() error
 }
 
-// ScriptExecutorSQL Basic structure to control script execution.
+// ScriptError A statement of a script failed.
+type ScriptError struct {
+	ScriptName string
+	// The line of the failed statement on the script.
+	Line int
+	Err  error
+}
+
+func (e ScriptError) Error() string {
+	return fmt.Sprintf("error executing %s on line %d: %s", e.ScriptName, e.Line, e.Err)
+}
+
+func (e ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ScriptExecutorSQL Basic structure to control script execution, it
+// opens and closes the transactions on the session according to the
+// transaction mode.
 type ScriptExecutorSQL struct {
-	Tx                *sql.Tx
+	Session           *session.Session
+	TransactionMode   database.TransactionMode
 	MigrationRegister registry.MigrationRegister
 }
 
-// CreateMigrationTable Creates the migration table with the migration register.
+// CreateMigrationTable Creates the migration table with the migration
+// register, inside its own transaction unless the transaction mode is
+// none.
 func (executor ScriptExecutorSQL) CreateMigrationTable() error {
-	return executor.MigrationRegister.CreateMigrationTable()
+	if executor.TransactionMode == database.TRANSACTION_NONE {
+		return executor.MigrationRegister.CreateMigrationTable()
+	}
+	return executor.inTransaction(executor.MigrationRegister.CreateMigrationTable)
 }
 
-// ProcessScripts Process all given scripts inside a single transaction.
-func (executor ScriptExecutorSQL) ProcessScripts(scripts []database.SQLScript) error {
-	for _, script := range scripts {
-		err := executor.processScript(script)
+// ProcessScripts Process all given scripts according to the transaction
+// mode, stopping at the first failure. Scripts that must be executed
+// outside a transaction are executed directly on the session when the
+// mode is per script, and can't be executed when the mode is all.
+// Returns the records of the scripts executed and kept, even on a
+// failure.
+func (executor ScriptExecutorSQL) ProcessScripts(scripts []database.SQLScript) ([]database.MigrationRecord, error) {
+	executed := map[string]database.MigrationRecord{}
+	completed, err := executor.forEachScript(scripts, func(script database.SQLScript) bool {
+		return script.NoTransaction
+	}, func(script database.SQLScript) error {
+		record, err := executor.processScript(script)
+		if record != nil {
+			executed[script.Name] = *record
+		}
+		return err
+	})
+
+	applied := []database.MigrationRecord{}
+	for _, script := range scripts[:completed] {
+		if record, ok := executed[script.Name]; ok {
+			applied = append(applied, record)
+		}
+	}
+	return applied, err
+}
+
+// UndoScripts Executes the undo script of every given script, in the
+// given order, and removes the script from the migration table. The
+// transactions are opened according to the transaction mode, like when
+// processing the scripts. Every script must have an undo script.
+func (executor ScriptExecutorSQL) UndoScripts(scripts []database.SQLScript) error {
+	_, err := executor.forEachScript(scripts, func(script database.SQLScript) bool {
+		return script.Undo.NoTransaction
+	}, executor.undoScript)
+	return err
+}
+
+// forEachScript Calls the function for all given scripts according to
+// the transaction mode, stopping at the first failure. On the per script
+// mode scripts for which noTransaction is true are processed without a
+// transaction. Returns how many scripts, from the first, were processed
+// and kept.
+func (executor ScriptExecutorSQL) forEachScript(scripts []database.SQLScript,
+	noTransaction func(script database.SQLScript) bool,
+	function func(script database.SQLScript) error) (int, error) {
+	completed := 0
+	processAll := func() error {
+		for _, script := range scripts {
+			err := function(script)
+			if err != nil {
+				return err
+			}
+			completed++
+		}
+		return nil
+	}
+
+	switch executor.TransactionMode {
+	case database.TRANSACTION_ALL:
+		err := executor.inTransaction(processAll)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		return completed, nil
+	case database.TRANSACTION_NONE:
+		err := processAll()
+		return completed, err
+	default:
+		for _, script := range scripts {
+			var err error
+			if noTransaction(script) {
+				err = function(script)
+			} else {
+				err = executor.inTransaction(func() error {
+					return function(script)
+				})
+			}
+			if err != nil {
+				return completed, err
+			}
+			completed++
+		}
+		return completed, nil
+	}
+}
+
+// inTransaction Executes the function inside a new transaction, the
+// transaction is committed if the function succeeds and rollbacked
+// otherwise.
+func (executor ScriptExecutorSQL) inTransaction(function func() error) error {
+	err := executor.Session.Begin()
+	if err != nil {
+		logrus.Error("Error starting transaction.\n", err)
+		return err
+	}
+
+	err = function()
+	if err != nil {
+		rollbackErr := executor.Session.Rollback()
+		if rollbackErr != nil {
+			logrus.Error("Error rollbacking transaction.\n", rollbackErr)
 		}
+		return err
+	}
+
+	err = executor.Session.Commit()
+	if err != nil {
+		logrus.Error("Error commiting transaction.\n", err)
+		return err
 	}
 	return nil
 }
 
-// processScript Process a given script inside the given transaction.
-func (executor ScriptExecutorSQL) processScript(script database.SQLScript) error {
+// processScript Process a given script in the current session, returns
+// the record of the script if it was executed.
+func (executor ScriptExecutorSQL) processScript(script database.SQLScript) (*database.MigrationRecord, error) {
 	isAlreadyProcessed, err := executor.MigrationRegister.IsScriptAlreadyExecuted(script)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// If already processed ignore script and just log.
@@ -52,59 +183,115 @@ func (executor ScriptExecutorSQL) processScript(script database.SQLScript) error
 		logrus.WithFields(logrus.Fields{
 			"script_name": script.Name,
 		}).Info("Script already executed.")
-	} else {
-		err = executor.executeScriptAndMarkAsExecuted(script)
-		if err != nil {
-			return err
-		}
+		return nil, nil
 	}
-	return nil
+	if script.NoTransaction && executor.Session.InTransaction() {
+		return nil, noTransactionError(script)
+	}
+	return executor.executeScriptAndMarkAsExecuted(script)
 }
 
-// executeScriptAndMarkAsExecuted Executes the given script and mark it as executed.
-func (executor ScriptExecutorSQL) executeScriptAndMarkAsExecuted(script database.SQLScript) error {
-	err := executeScript(executor.Tx, script)
+// undoScript Executes the undo script of the given script in the
+// current session and removes the script from the migration table.
+func (executor ScriptExecutorSQL) undoScript(script database.SQLScript) error {
+	if script.Undo.NoTransaction && executor.Session.InTransaction() {
+		return noTransactionError(*script.Undo)
+	}
+
+	err := executeScript(executor.Session, *script.Undo)
 	if err != nil {
 		return err
 	}
-	err = executor.MigrationRegister.MarkScriptAsExecuted(script)
+	return executor.MigrationRegister.RemoveScript(script.Name)
+}
+
+// noTransactionError Logs and returns the error of a script that must
+// be executed outside a transaction executed inside one.
+func noTransactionError(script database.SQLScript) error {
+	logrus.WithFields(logrus.Fields{
+		"script_name": script.Name,
+	}).Error("Script must be executed outside a transaction.")
+	return fmt.Errorf("script %s must be executed outside a transaction, use the per-script or none transaction mode",
+		script.Name)
+}
+
+// executeScriptAndMarkAsExecuted Executes the given script and mark it as executed.
+// Scripts that fail outside a transaction are marked as failed, since they may be
+// partially applied.
+func (executor ScriptExecutorSQL) executeScriptAndMarkAsExecuted(script database.SQLScript) (*database.MigrationRecord, error) {
+	start := time.Now()
+	err := executeScript(executor.Session, script)
 	if err != nil {
-		return err
+		if !executor.Session.InTransaction() {
+			markErr := executor.MigrationRegister.MarkScriptAsFailed(script, time.Since(start))
+			if markErr != nil {
+				logrus.WithFields(logrus.Fields{
+					"script_name": script.Name,
+				}).Error("Error marking the script as failed.\n", markErr)
+			}
+		}
+		return nil, err
 	}
-	return nil
+	executionTime := time.Since(start)
+	err = executor.MigrationRegister.MarkScriptAsExecuted(script, executionTime)
+	if err != nil {
+		return nil, err
+	}
+	return &database.MigrationRecord{
+		ScriptName:    script.Name,
+		Version:       script.Version,
+		Description:   script.Description,
+		Type:          script.Type,
+		Checksum:      script.Checksum(),
+		CreatedAt:     start,
+		ExecutionTime: executionTime,
+		Success:       true,
+	}, nil
 }
 
-// executeScript Executes a given SQL script.
-func executeScript(tx *sql.Tx, script database.SQLScript) error {
+// executeScript Executes every statement of a given SQL script.
+func executeScript(queryer session.Queryer, script database.SQLScript) error {
 	logrus.Info("Executing script: ", script.Name)
-	for _, statement := range strings.Split(script.Content, ";") {
-		_, err := tx.Exec(statement)
+	for _, statement := range splitter.Split(script.Content) {
+		_, err := queryer.Exec(statement.Content)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"script_name": script.Name,
+				"line":        statement.Line,
 			}).Error("Error executing script.", err)
 			fmt.Println("Statement executed:")
-			fmt.Println(statement)
-			return err
+			fmt.Println(statement.Content)
+			return ScriptError{ScriptName: script.Name, Line: statement.Line, Err: err}
 		}
 	}
 	return nil
 }
 
-// RollbackTransaction Rollback the given transaction.
-func (executor ScriptExecutorSQL) RollbackTransaction() {
-	err := executor.Tx.Rollback()
+// BeginTransaction Opens a transaction on the session, used by the
+// commands that must change the migration table atomically.
+func (executor ScriptExecutorSQL) BeginTransaction() error {
+	err := executor.Session.Begin()
+	if err != nil {
+		logrus.Error("Error starting transaction.\n", err)
+		return err
+	}
+	return nil
+}
+
+// RollbackTransaction Rollback the open transaction, if any.
+func (executor ScriptExecutorSQL) RollbackTransaction() error {
+	err := executor.Session.Rollback()
 	if err != nil {
-		logrus.Fatal("Error rollbacking transaction.\n", err)
+		logrus.Error("Error rollbacking transaction.\n", err)
 	}
-	logrus.Error("Migration executed unsuccessfully!")
+	return err
 }
 
-// CommitTransaction Commit to the given transaction.
-func (executor ScriptExecutorSQL) CommitTransaction() {
-	err := executor.Tx.Commit()
+// CommitTransaction Commit the open transaction, if any.
+func (executor ScriptExecutorSQL) CommitTransaction() error {
+	err := executor.Session.Commit()
 	if err != nil {
-		logrus.Fatal("Error commiting transaction.\n", err)
+		logrus.Error("Error commiting transaction.\n", err)
 	}
-	logrus.Info("Migration executed successfully!")
+	return err
 }
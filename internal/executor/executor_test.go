@@ -1,13 +1,16 @@
 package executor
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/eaneto/grotto/internal/session"
 	"github.com/eaneto/grotto/pkg/database"
-	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -26,15 +29,60 @@ func (m *MigrationRegisterMock) IsScriptAlreadyExecuted(script database.SQLScrip
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MigrationRegisterMock) MarkScriptAsExecuted(script database.SQLScript) error {
+func (m *MigrationRegisterMock) MarkScriptAsExecuted(script database.SQLScript, executionTime time.Duration) error {
 	args := m.Called()
 	return args.Error(0)
 }
 
-func TestProcessScriptWithNilTransactionShouldPanic(t *testing.T) {
+func (m *MigrationRegisterMock) MarkScriptAsFailed(script database.SQLScript, executionTime time.Duration) error {
+	args := m.Called(script)
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) MigrationTableExists() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MigrationRegisterMock) UpgradeMigrationTable() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) ExecutedScripts() ([]database.MigrationRecord, error) {
+	args := m.Called()
+	return args.Get(0).([]database.MigrationRecord), args.Error(1)
+}
+
+func (m *MigrationRegisterMock) RemoveScript(scriptName string) error {
+	args := m.Called(scriptName)
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) UpdateChecksum(scriptName string, checksum string) error {
+	args := m.Called(scriptName, checksum)
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) MarkScriptAsDeleted(scriptName string) error {
+	args := m.Called(scriptName)
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) InsertBaseline(version database.Version, description string) error {
+	args := m.Called(version, description)
+	return args.Error(0)
+}
+
+func (m *MigrationRegisterMock) IsSchemaEmpty() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+func TestProcessScriptWithNilSessionShouldPanic(t *testing.T) {
 	migrationRegister := new(MigrationRegisterMock)
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                nil,
+		Session:           nil,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -50,10 +98,15 @@ func TestProcessScriptWithNilTransactionShouldPanic(t *testing.T) {
 	migrationRegister.AssertExpectations(t)
 }
 
-func TestCreateMigrationTableWithSuccessShouldReturnSameResult(t *testing.T) {
+func TestCreateMigrationTableWithSuccessShouldCommitAndReturnSameResult(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+	dbMock.ExpectBegin()
+	dbMock.ExpectCommit()
+
 	migrationRegister := new(MigrationRegisterMock)
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                nil,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
 	migrationRegister.On("CreateMigrationTable").Return(nil)
@@ -62,12 +115,18 @@ func TestCreateMigrationTableWithSuccessShouldReturnSameResult(t *testing.T) {
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
+	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestCreateMigrationTableWithErrorShouldReturnSameResult(t *testing.T) {
+func TestCreateMigrationTableWithErrorShouldRollbackAndReturnSameResult(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+	dbMock.ExpectBegin()
+	dbMock.ExpectRollback()
+
 	migrationRegister := new(MigrationRegisterMock)
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                nil,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
 	expectedError := errors.New("Error creating migration table")
@@ -77,34 +136,53 @@ func TestCreateMigrationTableWithErrorShouldReturnSameResult(t *testing.T) {
 
 	assert.Equal(t, expectedError, actualError)
 	migrationRegister.AssertExpectations(t)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestCreateMigrationTableWithoutTransactionShouldNotBeginTransaction(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_NONE,
+		MigrationRegister: migrationRegister,
+	}
+	migrationRegister.On("CreateMigrationTable").Return(nil)
+
+	error := scriptExecutor.CreateMigrationTable()
+
+	assert.Nil(t, error)
+	migrationRegister.AssertExpectations(t)
+	assertDatabaseExpectations(t, dbMock)
 }
 
 func TestProcessScriptWithEmptyListShouldNotReturnErrorAndDoNothing(t *testing.T) {
-	db, mock, _ := sqlmock.New()
+	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
-	mock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
 	scripts := []database.SQLScript{}
 
-	error := scriptExecutor.ProcessScripts(scripts)
+	_, error := scriptExecutor.ProcessScripts(scripts)
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
-	assertDatabaseExpectations(t, mock)
+	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestProcessOneScriptWithErrorCheckingIfTheScriptWasExecutedShouldReturnError(t *testing.T) {
+func TestProcessOneScriptWithErrorCheckingIfTheScriptWasExecutedShouldRollbackAndReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
+	dbMock.ExpectRollback()
 
 	migrationRegister := new(MigrationRegisterMock)
 	expectedError := errors.New("Error checking if the script was executed")
@@ -112,7 +190,8 @@ func TestProcessOneScriptWithErrorCheckingIfTheScriptWasExecutedShouldReturnErro
 		Return(false, expectedError)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -122,7 +201,7 @@ func TestProcessOneScriptWithErrorCheckingIfTheScriptWasExecutedShouldReturnErro
 			Content: "INSERT INTO USERS VALUES ('id')",
 		},
 	}
-	actualError := scriptExecutor.ProcessScripts(scripts)
+	_, actualError := scriptExecutor.ProcessScripts(scripts)
 
 	assert.NotNil(t, actualError)
 	assert.Equal(t, expectedError, actualError)
@@ -134,13 +213,14 @@ func TestProcessOneScriptWithAlreadyProcessedScriptShouldNotReturnError(t *testi
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
+	dbMock.ExpectCommit()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(true, nil)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -150,18 +230,16 @@ func TestProcessOneScriptWithAlreadyProcessedScriptShouldNotReturnError(t *testi
 			Content: "INSERT INTO USERS VALUES ('id')",
 		},
 	}
-	error := scriptExecutor.ProcessScripts(scripts)
+	_, error := scriptExecutor.ProcessScripts(scripts)
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestProcessOneUnexecutedScriptAndErrorMarkingAsExecutedShouldReturnError(t *testing.T) {
+func TestProcessOneUnexecutedScriptAndErrorMarkingAsExecutedShouldRollbackAndReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
-	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
@@ -169,7 +247,8 @@ func TestProcessOneUnexecutedScriptAndErrorMarkingAsExecutedShouldReturnError(t
 	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(expectedError)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -179,10 +258,12 @@ func TestProcessOneUnexecutedScriptAndErrorMarkingAsExecutedShouldReturnError(t
 			Content: "INSERT INTO USERS VALUES ('id')",
 		},
 	}
+	dbMock.ExpectBegin()
 	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectRollback()
 
-	actualError := scriptExecutor.ProcessScripts(scripts)
+	_, actualError := scriptExecutor.ProcessScripts(scripts)
 
 	assert.NotNil(t, actualError)
 	assert.Equal(t, expectedError, actualError)
@@ -190,17 +271,16 @@ func TestProcessOneUnexecutedScriptAndErrorMarkingAsExecutedShouldReturnError(t
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestProcessOneUnexecutedScriptWithExecutingShouldReturnError(t *testing.T) {
+func TestProcessOneUnexecutedScriptWithExecutingShouldRollbackAndReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
-	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -211,13 +291,15 @@ func TestProcessOneUnexecutedScriptWithExecutingShouldReturnError(t *testing.T)
 		},
 	}
 	expectedError := errors.New("Error processing script.")
+	dbMock.ExpectBegin()
 	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
 		WillReturnError(expectedError)
+	dbMock.ExpectRollback()
 
-	actualError := scriptExecutor.ProcessScripts(scripts)
+	_, actualError := scriptExecutor.ProcessScripts(scripts)
 
 	assert.NotNil(t, actualError)
-	assert.Equal(t, expectedError, actualError)
+	assert.ErrorIs(t, actualError, expectedError)
 	migrationRegister.AssertNotCalled(t, "MarkScriptAsExecuted", mock.Anything)
 	migrationRegister.AssertExpectations(t)
 	assertDatabaseExpectations(t, dbMock)
@@ -226,15 +308,14 @@ func TestProcessOneUnexecutedScriptWithExecutingShouldReturnError(t *testing.T)
 func TestProcessOneUnexecutedScriptShouldExecuteScriptContentAndNotReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
-	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
 	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -244,28 +325,29 @@ func TestProcessOneUnexecutedScriptShouldExecuteScriptContentAndNotReturnError(t
 			Content: "INSERT INTO USERS VALUES ('id')",
 		},
 	}
+	dbMock.ExpectBegin()
 	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
 
-	error := scriptExecutor.ProcessScripts(scripts)
+	_, error := scriptExecutor.ProcessScripts(scripts)
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestProcessTwoUnexecutedScriptShouldExecuteScriptContentAndNotReturnError(t *testing.T) {
+func TestProcessTwoUnexecutedScriptPerScriptShouldCommitEachScript(t *testing.T) {
 	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
-	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
 	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -280,28 +362,328 @@ func TestProcessTwoUnexecutedScriptShouldExecuteScriptContentAndNotReturnError(t
 		},
 	}
 	for _, script := range scripts {
+		dbMock.ExpectBegin()
 		dbMock.ExpectExec(regexp.QuoteMeta(script.Content)).
 			WillReturnResult(sqlmock.NewResult(1, 1))
+		dbMock.ExpectCommit()
 	}
 
-	error := scriptExecutor.ProcessScripts(scripts)
+	_, error := scriptExecutor.ProcessScripts(scripts)
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestProcessOneExecutedAndOneUnexecutedScriptShouldExecuteOneScriptContentAndNotReturnError(t *testing.T) {
+func TestProcessTwoScriptsPerScriptWithErrorOnSecondShouldKeepTheFirst(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Content: "INSERT INTO USERS VALUES ('id')"},
+		{Name: "V2__second.sql", Content: "INVALID"},
+		{Name: "V3__third.sql", Content: "UPDATE TABLE SET NAME = ''"},
+	}
+	expectedError := errors.New("syntax error")
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(scripts[1].Content).WillReturnError(expectedError)
+	dbMock.ExpectRollback()
+
+	applied, actualError := scriptExecutor.ProcessScripts(scripts)
+
+	assert.Equal(t, ScriptError{ScriptName: "V2__second.sql", Line: 1, Err: expectedError}, actualError)
+	assert.Equal(t, 1, len(applied))
+	assert.Equal(t, "V1__first.sql", applied[0].ScriptName)
+	migrationRegister.AssertNumberOfCalls(t, "MarkScriptAsExecuted", 1)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessTwoScriptsInSingleTransactionShouldCommitOnce(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_ALL,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Content: "INSERT INTO USERS VALUES ('id')"},
+		{Name: "V2__second.sql", Content: "UPDATE TABLE SET NAME = ''"},
+	}
+	dbMock.ExpectBegin()
+	for _, script := range scripts {
+		dbMock.ExpectExec(regexp.QuoteMeta(script.Content)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	dbMock.ExpectCommit()
+
+	applied, error := scriptExecutor.ProcessScripts(scripts)
+
+	assert.Nil(t, error)
+	assert.Equal(t, 2, len(applied))
+	assert.Equal(t, "V1__first.sql", applied[0].ScriptName)
+	assert.Equal(t, "V2__second.sql", applied[1].ScriptName)
+	assert.True(t, applied[1].Success)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessTwoScriptsInSingleTransactionWithErrorShouldRollbackEverything(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_ALL,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Content: "INSERT INTO USERS VALUES ('id')"},
+		{Name: "V2__second.sql", Content: "INVALID"},
+	}
+	expectedError := errors.New("syntax error")
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectExec(scripts[1].Content).WillReturnError(expectedError)
+	dbMock.ExpectRollback()
+
+	applied, actualError := scriptExecutor.ProcessScripts(scripts)
+
+	assert.ErrorIs(t, actualError, expectedError)
+	assert.Empty(t, applied)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessScriptsWithoutTransactionShouldNotBeginTransaction(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_NONE,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Content: "INSERT INTO USERS VALUES ('id')"},
+	}
+	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	_, error := scriptExecutor.ProcessScripts(scripts)
+
+	assert.Nil(t, error)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessNoTransactionScriptPerScriptShouldExecuteOutsideTransaction(t *testing.T) {
 	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{Name: "V1__table.sql", Content: "CREATE TABLE users (id int)"},
+		{
+			Name:          "V2__index.sql",
+			Content:       "CREATE INDEX CONCURRENTLY idx ON users (id)",
+			NoTransaction: true,
+		},
+	}
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
+	dbMock.ExpectExec(regexp.QuoteMeta(scripts[0].Content)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+	dbMock.ExpectExec(regexp.QuoteMeta(scripts[1].Content)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, error := scriptExecutor.ProcessScripts(scripts)
+
+	assert.Nil(t, error)
+	migrationRegister.AssertNumberOfCalls(t, "MarkScriptAsExecuted", 2)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessNoTransactionScriptWithErrorShouldMarkScriptAsFailed(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{
+			Name:          "V1__index.sql",
+			Content:       "CREATE INDEX CONCURRENTLY idx ON users (id)",
+			NoTransaction: true,
+		},
+	}
+	migrationRegister.On("MarkScriptAsFailed", scripts[0]).Return(nil)
+	expectedError := errors.New("deadlock detected")
+	dbMock.ExpectExec("CREATE INDEX CONCURRENTLY").WillReturnError(expectedError)
+
+	_, actualError := scriptExecutor.ProcessScripts(scripts)
+
+	assert.ErrorIs(t, actualError, expectedError)
+	migrationRegister.AssertExpectations(t)
+	migrationRegister.AssertNotCalled(t, "MarkScriptAsExecuted", mock.Anything)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessNoTransactionScriptInSingleTransactionShouldReturnError(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_ALL,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{
+			Name:          "V1__index.sql",
+			Content:       "CREATE INDEX CONCURRENTLY idx ON users (id)",
+			NoTransaction: true,
+		},
+	}
+	dbMock.ExpectBegin()
+	dbMock.ExpectRollback()
+
+	_, error := scriptExecutor.ProcessScripts(scripts)
+
+	assert.NotNil(t, error)
+	assert.Contains(t, error.Error(), "outside a transaction")
+	migrationRegister.AssertNotCalled(t, "MarkScriptAsFailed", mock.Anything)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestUndoScriptsPerScriptShouldExecuteUndoScriptsAndRemoveThem(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("RemoveScript", "V2__index.sql").Return(nil)
+	migrationRegister.On("RemoveScript", "V1__table.sql").Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{
+			Name: "V2__index.sql",
+			Undo: &database.SQLScript{
+				Name:          "U2__index.sql",
+				Content:       "DROP INDEX CONCURRENTLY idx",
+				NoTransaction: true,
+			},
+		},
+		{
+			Name: "V1__table.sql",
+			Undo: &database.SQLScript{Name: "U1__table.sql", Content: "DROP TABLE users"},
+		},
+	}
+	dbMock.ExpectExec("DROP INDEX CONCURRENTLY idx").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DROP TABLE users").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	err := scriptExecutor.UndoScripts(scripts)
+
+	assert.Nil(t, err)
+	migrationRegister.AssertExpectations(t)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestUndoScriptsWithErrorShouldRollbackAndKeepTheScript(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_ALL,
+		MigrationRegister: migrationRegister,
+	}
+
+	scripts := []database.SQLScript{
+		{
+			Name: "V1__table.sql",
+			Undo: &database.SQLScript{Name: "U1__table.sql", Content: "DROP TABLE users"},
+		},
+	}
+	expectedError := errors.New("table is referenced")
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DROP TABLE users").WillReturnError(expectedError)
+	dbMock.ExpectRollback()
+
+	err := scriptExecutor.UndoScripts(scripts)
+
+	assert.ErrorIs(t, err, expectedError)
+	migrationRegister.AssertNotCalled(t, "RemoveScript", mock.Anything)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestProcessOneExecutedAndOneUnexecutedScriptShouldExecuteOneScriptContentAndNotReturnError(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
 
 	migrationRegister := new(MigrationRegisterMock)
 	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_ALL,
 		MigrationRegister: migrationRegister,
 	}
 
@@ -317,28 +699,75 @@ func TestProcessOneExecutedAndOneUnexecutedScriptShouldExecuteOneScriptContentAn
 	}
 	migrationRegister.On("IsScriptAlreadyExecuted", scripts[0]).Return(true, nil)
 	migrationRegister.On("IsScriptAlreadyExecuted", scripts[1]).Return(false, nil)
+	dbMock.ExpectBegin()
 	dbMock.ExpectExec(regexp.QuoteMeta(scripts[1].Content)).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
 
-	error := scriptExecutor.ProcessScripts(scripts)
+	_, error := scriptExecutor.ProcessScripts(scripts)
 
 	assert.Nil(t, error)
 	migrationRegister.AssertExpectations(t)
 	assertDatabaseExpectations(t, dbMock)
 }
 
+func TestProcessScriptWithFunctionBodyShouldExecuteEveryStatementOnce(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	defer db.Close()
+
+	migrationRegister := new(MigrationRegisterMock)
+	migrationRegister.On("IsScriptAlreadyExecuted", mock.Anything).Return(false, nil)
+	migrationRegister.On("MarkScriptAsExecuted", mock.Anything).Return(nil)
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		TransactionMode:   database.TRANSACTION_PER_SCRIPT,
+		MigrationRegister: migrationRegister,
+	}
+
+	function := "CREATE FUNCTION one() RETURNS int AS $$ BEGIN RETURN 1; END; $$ LANGUAGE plpgsql"
+	insert := "INSERT INTO users VALUES ('a;b')"
+	scripts := []database.SQLScript{
+		{Name: "V1__function.sql", Content: function + ";\n-- comment;\n" + insert + ";\n"},
+	}
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(function).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectCommit()
+
+	_, error := scriptExecutor.ProcessScripts(scripts)
+
+	assert.Nil(t, error)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestBeginTransactionTwiceShouldReturnError(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+	dbMock.ExpectBegin()
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		MigrationRegister: new(MigrationRegisterMock),
+	}
+
+	assert.Nil(t, scriptExecutor.BeginTransaction())
+	assert.NotNil(t, scriptExecutor.BeginTransaction())
+	assertDatabaseExpectations(t, dbMock)
+}
+
 func TestCommitWithSuccessShouldCommitAndDoNothing(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
+	scriptExecutor.BeginTransaction()
 
 	dbMock.ExpectCommit()
 
@@ -347,18 +776,33 @@ func TestCommitWithSuccessShouldCommitAndDoNothing(t *testing.T) {
 	assertDatabaseExpectations(t, dbMock)
 }
 
+func TestCommitWithoutTransactionShouldDoNothing(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	defer db.Close()
+
+	scriptExecutor := ScriptExecutorSQL{
+		Session:           newSession(t, db),
+		MigrationRegister: new(MigrationRegisterMock),
+	}
+
+	scriptExecutor.CommitTransaction()
+	scriptExecutor.RollbackTransaction()
+
+	assertDatabaseExpectations(t, dbMock)
+}
+
 func TestRollbackWithSuccessShouldRollbackAndDoNothing(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
 
 	migrationRegister := new(MigrationRegisterMock)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
+	scriptExecutor.BeginTransaction()
 
 	dbMock.ExpectRollback()
 
@@ -367,56 +811,58 @@ func TestRollbackWithSuccessShouldRollbackAndDoNothing(t *testing.T) {
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestCommitWithErrorShouldLogFatal(t *testing.T) {
+func TestCommitWithErrorShouldReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
+	expectedError := errors.New("Error")
 	dbMock.ExpectCommit().
-		WillReturnError(errors.New("Error"))
+		WillReturnError(expectedError)
 
 	migrationRegister := new(MigrationRegisterMock)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
+	scriptExecutor.BeginTransaction()
 
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-	var fatal bool
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
+	err := scriptExecutor.CommitTransaction()
 
-	scriptExecutor.CommitTransaction()
-
-	assert.True(t, fatal)
+	assert.Equal(t, expectedError, err)
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestRollbackWithErrorShouldLogFatal(t *testing.T) {
+func TestRollbackWithErrorShouldReturnError(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
 	dbMock.ExpectBegin()
-	tx, _ := db.Begin()
+	expectedError := errors.New("Error")
 	dbMock.ExpectRollback().
-		WillReturnError(errors.New("Error"))
+		WillReturnError(expectedError)
 
 	migrationRegister := new(MigrationRegisterMock)
 
 	scriptExecutor := ScriptExecutorSQL{
-		Tx:                tx,
+		Session:           newSession(t, db),
 		MigrationRegister: migrationRegister,
 	}
+	scriptExecutor.BeginTransaction()
 
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-	var fatal bool
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
+	err := scriptExecutor.RollbackTransaction()
 
-	scriptExecutor.RollbackTransaction()
-
-	assert.True(t, fatal)
+	assert.Equal(t, expectedError, err)
 	assertDatabaseExpectations(t, dbMock)
 }
 
+func newSession(t *testing.T, db *sql.DB) *session.Session {
+	databaseSession, err := session.New(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Error creating session: %s", err)
+	}
+	return databaseSession
+}
+
 func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Not all expectation were met: %s", err)
@@ -0,0 +1,91 @@
+package lock
+
+import (
+	"errors"
+	"hash/fnv"
+	"time"
+
+	"github.com/eaneto/grotto/internal/session"
+	"github.com/sirupsen/logrus"
+)
+
+// DEFAULT_POLL_INTERVAL How long to wait between attempts to acquire the
+// lock while another session holds it.
+const DEFAULT_POLL_INTERVAL = 500 * time.Millisecond
+
+// ErrLockTimeout The lock was held by another session for longer than
+// the timeout.
+var ErrLockTimeout = errors.New("timed out waiting for the migration lock, another migration may be running")
+
+// Locker Basic interface for the migration lock.
+type Locker interface {
+	Lock(timeout time.Duration) error
+	Unlock() error
+}
+
+// AdvisoryLockerSQL Migration lock with a PostgreSQL session level
+// advisory lock, it's held by the connection of the session until it's
+// unlocked or the connection is closed.
+type AdvisoryLockerSQL struct {
+	// Session in which the lock is acquired, it must always use the
+	// same connection.
+	Tx session.Queryer
+	// The advisory lock key, see Key.
+	Key int64
+	// How long to wait between attempts, DEFAULT_POLL_INTERVAL if zero.
+	PollInterval time.Duration
+}
+
+// Key Returns the advisory lock key for the given name, every process
+// using the same name gets the same key.
+func Key(name string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return int64(hash.Sum64())
+}
+
+// Lock Acquires the advisory lock, waiting up to the timeout while
+// another session holds it. Returns ErrLockTimeout if the lock was not
+// acquired in time.
+func (l AdvisoryLockerSQL) Lock(timeout time.Duration) error {
+	pollInterval := l.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = DEFAULT_POLL_INTERVAL
+	}
+
+	deadline := time.Now().Add(timeout)
+	for waiting := false; ; waiting = true {
+		var acquired bool
+		err := l.Tx.QueryRow("SELECT pg_try_advisory_lock($1)", l.Key).Scan(&acquired)
+		if err != nil {
+			logrus.Error("Error acquiring the migration lock.\n", err)
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return ErrLockTimeout
+		}
+		if !waiting {
+			logrus.Info("Waiting for another migration to release the migration lock.")
+		}
+		if remaining < pollInterval {
+			time.Sleep(remaining)
+		} else {
+			time.Sleep(pollInterval)
+		}
+	}
+}
+
+// Unlock Releases the advisory lock.
+func (l AdvisoryLockerSQL) Unlock() error {
+	_, err := l.Tx.Exec("SELECT pg_advisory_unlock($1)", l.Key)
+	if err != nil {
+		logrus.Error("Error releasing the migration lock.\n", err)
+		return err
+	}
+	return nil
+}
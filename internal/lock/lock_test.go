@@ -0,0 +1,114 @@
+package lock
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyShouldBeTheSameForTheSameName(t *testing.T) {
+	assert.Equal(t, Key("grotto_migration"), Key("grotto_migration"))
+	assert.NotEqual(t, Key("grotto_migration"), Key("other_migration"))
+}
+
+func TestLockAvailableShouldAcquireItImmediately(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+
+	err := locker.Lock(time.Second)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestLockHeldByAnotherSessionShouldWaitUntilItIsReleased(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42, PollInterval: time.Millisecond}
+	for _, acquired := range []bool{false, false, true} {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).
+			WithArgs(int64(42)).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(acquired))
+	}
+
+	err := locker.Lock(time.Minute)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestLockHeldLongerThanTimeoutShouldReturnTimeoutError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42, PollInterval: time.Millisecond}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).
+		WithArgs(int64(42)).
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	err := locker.Lock(0)
+
+	assert.Equal(t, ErrLockTimeout, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestLockWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42}
+	expectedError := errors.New("connection refused")
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).
+		WillReturnError(expectedError)
+
+	err := locker.Lock(time.Second)
+
+	assert.Equal(t, expectedError, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUnlockShouldReleaseTheLock(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42}
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+		WithArgs(int64(42)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := locker.Unlock()
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUnlockWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	locker := AdvisoryLockerSQL{Tx: db, Key: 42}
+	expectedError := errors.New("connection closed")
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+		WillReturnError(expectedError)
+
+	err := locker.Unlock()
+
+	assert.Equal(t, expectedError, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
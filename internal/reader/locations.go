@@ -0,0 +1,168 @@
+package reader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/eaneto/grotto/pkg/database"
+)
+
+// MigrationReaderLocations Migration reader for several migration
+// directories, their scripts are merged in a single execution order.
+type MigrationReaderLocations struct {
+	// The file system of the locations, the operating system's if nil.
+	FS fs.FS
+	// The migration directories, a location can be a glob pattern
+	// matching several directories, like modules/*/migrations.
+	Locations []string
+}
+
+// DuplicateScriptError Two locations have a repeatable script with the
+// same name.
+type DuplicateScriptError struct {
+	Paths []string
+}
+
+func (e DuplicateScriptError) Error() string {
+	return fmt.Sprintf("found more than one script with the same name: %s", strings.Join(e.Paths, ", "))
+}
+
+// locatedScript A script and the migration directory it was read from.
+type locatedScript struct {
+	script    database.SQLScript
+	directory string
+}
+
+// ReadScriptFiles Reads the scripts of every migration directory, like
+// a single migration directory. Returns a DuplicateVersionError, with
+// the path of both scripts, if two directories have the same version.
+// Undo scripts are paired with the versioned scripts of their own
+// directory.
+func (r MigrationReaderLocations) ReadScriptFiles() ([]database.SQLScript, error) {
+	directories, err := r.directories()
+	if err != nil {
+		return nil, err
+	}
+
+	located := []locatedScript{}
+	for _, directory := range directories {
+		scripts, err := r.reader(directory).ReadScriptFiles()
+		if err != nil {
+			return nil, err
+		}
+		for _, script := range scripts {
+			located = append(located, locatedScript{script: script, directory: directory})
+		}
+	}
+
+	sort.SliceStable(located, func(i, j int) bool {
+		return lessScript(located[i].script, located[j].script)
+	})
+	scripts := make([]database.SQLScript, len(located))
+	for index := range located {
+		if index > 0 {
+			err = r.checkDuplicate(located[index-1], located[index])
+			if err != nil {
+				return nil, err
+			}
+		}
+		scripts[index] = located[index].script
+	}
+	return scripts, nil
+}
+
+// directories Expands the glob patterns of the locations into the
+// migration directories, every directory is read only once.
+func (r MigrationReaderLocations) directories() ([]string, error) {
+	if len(r.Locations) == 0 {
+		return nil, ReadError{Path: "", Err: fs.ErrInvalid}
+	}
+
+	directories := []string{}
+	seen := map[string]bool{}
+	for _, location := range r.Locations {
+		matches := []string{location}
+		if strings.ContainsAny(location, "*?[") {
+			var err error
+			matches, err = r.glob(location)
+			if err != nil {
+				return nil, ReadError{Path: location, Err: err}
+			}
+			if len(matches) == 0 {
+				return nil, ReadError{Path: location, Err: fs.ErrNotExist}
+			}
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				directories = append(directories, match)
+			}
+		}
+	}
+	return directories, nil
+}
+
+// glob Returns the directories matching the pattern.
+func (r MigrationReaderLocations) glob(pattern string) ([]string, error) {
+	var matches []string
+	var err error
+	if r.FS != nil {
+		matches, err = fs.Glob(r.FS, pattern)
+	} else {
+		matches, err = filepath.Glob(pattern)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	directories := []string{}
+	for _, match := range matches {
+		var info fs.FileInfo
+		if r.FS != nil {
+			info, err = fs.Stat(r.FS, match)
+		} else {
+			info, err = os.Stat(match)
+		}
+		if err == nil && info.IsDir() {
+			directories = append(directories, match)
+		}
+	}
+	return directories, nil
+}
+
+// reader Returns the reader of a single migration directory.
+func (r MigrationReaderLocations) reader(directory string) MigrationReader {
+	if r.FS != nil {
+		return MigrationReaderIOFS{FS: r.FS, Directory: directory}
+	}
+	return MigrationReaderFS{MigrationDirectory: directory}
+}
+
+// checkDuplicate Returns an error if two consecutive scripts, in
+// execution order, have the same version or the same repeatable name.
+func (r MigrationReaderLocations) checkDuplicate(previous, current locatedScript) error {
+	if previous.script.Type != current.script.Type {
+		return nil
+	}
+	paths := []string{r.join(previous), r.join(current)}
+	switch {
+	case current.script.Type == database.SCRIPT_VERSIONED && previous.script.Version.Compare(current.script.Version) == 0:
+		return DuplicateVersionError{Version: current.script.Version, FileNames: paths}
+	case current.script.Type == database.SCRIPT_REPEATABLE && previous.script.Name == current.script.Name:
+		return DuplicateScriptError{Paths: paths}
+	}
+	return nil
+}
+
+// join Returns the path of the script with its directory.
+func (r MigrationReaderLocations) join(located locatedScript) string {
+	if r.FS != nil {
+		return path.Join(located.directory, located.script.Name)
+	}
+	return filepath.Join(located.directory, located.script.Name)
+}
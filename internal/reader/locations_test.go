@@ -0,0 +1,135 @@
+package reader
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/eaneto/grotto/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLocationsShouldMergeTheScriptsByVersion(t *testing.T) {
+	reader := MigrationReaderLocations{
+		FS: fstest.MapFS{
+			"core/V1__create_users.sql":    {Data: []byte("create table users();")},
+			"core/V3__create_orders.sql":   {Data: []byte("create table orders();")},
+			"billing/V2__create_plans.sql": {Data: []byte("create table plans();")},
+			"billing/R__views.sql":         {Data: []byte("create view v as select 1;")},
+		},
+		Locations: []string{"core", "billing"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	names := []string{}
+	for _, script := range scripts {
+		names = append(names, script.Name)
+	}
+	assert.Equal(t, []string{
+		"V1__create_users.sql",
+		"V2__create_plans.sql",
+		"V3__create_orders.sql",
+		"R__views.sql",
+	}, names)
+}
+
+func TestReadLocationsWithGlobPatternShouldReadEveryMatchingDirectory(t *testing.T) {
+	reader := MigrationReaderLocations{
+		FS: fstest.MapFS{
+			"modules/users/migrations/V1__create_users.sql": {Data: []byte("create table users();")},
+			"modules/plans/migrations/V2__create_plans.sql": {Data: []byte("create table plans();")},
+			"modules/plans/README.md":                       {Data: []byte("plans")},
+		},
+		Locations: []string{"modules/*/migrations", "modules/users/migrations"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.Len(t, scripts, 2)
+	assert.Equal(t, "V1__create_users.sql", scripts[0].Name)
+	assert.Equal(t, "V2__create_plans.sql", scripts[1].Name)
+}
+
+func TestReadLocationsWithSameVersionShouldReturnDuplicateVersionError(t *testing.T) {
+	reader := MigrationReaderLocations{
+		FS: fstest.MapFS{
+			"core/V1__create_users.sql":      {Data: []byte("create table users();")},
+			"billing/V1.0__create_plans.sql": {Data: []byte("create table plans();")},
+		},
+		Locations: []string{"core", "billing"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	var duplicateError DuplicateVersionError
+	assert.ErrorAs(t, err, &duplicateError)
+	assert.Equal(t, database.Version{1, 0}, duplicateError.Version)
+	assert.Equal(t, []string{"core/V1__create_users.sql", "billing/V1.0__create_plans.sql"}, duplicateError.FileNames)
+	assert.Nil(t, scripts)
+}
+
+func TestReadLocationsWithSameRepeatableScriptShouldReturnDuplicateScriptError(t *testing.T) {
+	reader := MigrationReaderLocations{
+		FS: fstest.MapFS{
+			"core/R__views.sql":    {Data: []byte("create view a as select 1;")},
+			"billing/R__views.sql": {Data: []byte("create view b as select 1;")},
+		},
+		Locations: []string{"core", "billing"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	var duplicateError DuplicateScriptError
+	assert.ErrorAs(t, err, &duplicateError)
+	assert.Equal(t, []string{"core/R__views.sql", "billing/R__views.sql"}, duplicateError.Paths)
+	assert.Nil(t, scripts)
+}
+
+func TestReadLocationsWithUnmatchedGlobPatternShouldReturnReadError(t *testing.T) {
+	reader := MigrationReaderLocations{
+		FS:        fstest.MapFS{},
+		Locations: []string{"modules/*/migrations"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	var readError ReadError
+	assert.ErrorAs(t, err, &readError)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, "modules/*/migrations", readError.Path)
+	assert.Nil(t, scripts)
+}
+
+func TestReadWithoutLocationsShouldReturnReadError(t *testing.T) {
+	reader := MigrationReaderLocations{}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	assert.Nil(t, scripts)
+}
+
+func TestReadLocationsOnOperatingSystemShouldReadEveryDirectory(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.MkdirAll(dir+"/core", os.ModePerm)
+	os.MkdirAll(dir+"/billing", os.ModePerm)
+	ioutil.WriteFile(dir+"/core/V1__create_users.sql", []byte("create table users();"), os.ModePerm)
+	ioutil.WriteFile(dir+"/billing/V2__create_plans.sql", []byte("create table plans();"), os.ModePerm)
+
+	reader := MigrationReaderLocations{
+		Locations: []string{dir + "/*"},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.Len(t, scripts, 2)
+	assert.Equal(t, "V1__create_users.sql", scripts[0].Name)
+	assert.Equal(t, "V2__create_plans.sql", scripts[1].Name)
+}
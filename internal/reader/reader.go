@@ -1,8 +1,13 @@
 package reader
 
 import (
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -10,9 +15,84 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// VERSIONED_SCRIPT_PATTERN The pattern every script name must follow,
+// V<version>__<description>.sql, where the version parts are separated
+// by dots or underscores, like V1.2__create_table.sql.
+var VERSIONED_SCRIPT_PATTERN = regexp.MustCompile(`^V(\d+(?:[._]\d+)*)__(.+)\.sql$`)
+
+// REPEATABLE_SCRIPT_PATTERN The pattern for repeatable scripts,
+// R__<description>.sql, which have no version.
+var REPEATABLE_SCRIPT_PATTERN = regexp.MustCompile(`^R__(.+)\.sql$`)
+
+// UNDO_SCRIPT_PATTERN The pattern for undo scripts,
+// U<version>__<description>.sql, which revert the versioned script with
+// the same version.
+var UNDO_SCRIPT_PATTERN = regexp.MustCompile(`^U(\d+(?:[._]\d+)*)__(.+)\.sql$`)
+
+// NO_TRANSACTION_DIRECTIVE The comment on the script header that marks
+// the script to be executed outside a transaction.
+const NO_TRANSACTION_DIRECTIVE = "grotto:no-transaction"
+
 // MigrationReader Basic interface for the migration reader.
 type MigrationReader interface {
-	ReadScriptFiles() []database.SQLScript
+	ReadScriptFiles() ([]database.SQLScript, error)
+}
+
+// ReadError The migration directory or a script couldn't be read.
+type ReadError struct {
+	Path string
+	Err  error
+}
+
+func (e ReadError) Error() string {
+	return fmt.Sprintf("error reading %s: %s", e.Path, e.Err)
+}
+
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
+// ScriptNameError The script name doesn't follow the versioned, the
+// repeatable or the undo pattern.
+type ScriptNameError struct {
+	FileName string
+	// The error parsing the version, nil if the name doesn't match any
+	// pattern.
+	Err error
+}
+
+func (e ScriptNameError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("invalid script version on %s: %s", e.FileName, e.Err)
+	}
+	return fmt.Sprintf("invalid script name %s, expected V<version>__<description>.sql, "+
+		"R__<description>.sql or U<version>__<description>.sql", e.FileName)
+}
+
+func (e ScriptNameError) Unwrap() error {
+	return e.Err
+}
+
+// DuplicateVersionError Two versioned scripts, or two undo scripts,
+// have the same version.
+type DuplicateVersionError struct {
+	Version   database.Version
+	FileNames []string
+}
+
+func (e DuplicateVersionError) Error() string {
+	return fmt.Sprintf("found more than one script with the version %s: %s",
+		e.Version, strings.Join(e.FileNames, ", "))
+}
+
+// UndoWithoutScriptError An undo script has no versioned script with
+// the same version.
+type UndoWithoutScriptError struct {
+	FileName string
+}
+
+func (e UndoWithoutScriptError) Error() string {
+	return fmt.Sprintf("undo script %s without a versioned script with the same version", e.FileName)
 }
 
 // MigrationReaderFS Basic structure for the migration script file system reader.
@@ -20,67 +100,227 @@ type MigrationReaderFS struct {
 	MigrationDirectory string
 }
 
-type ByName []os.FileInfo
+// ReadScriptFiles Reads the scripts on the migration directory of the
+// operating system, like MigrationReaderIOFS. The path of a ReadError
+// includes the migration directory.
+func (r MigrationReaderFS) ReadScriptFiles() ([]database.SQLScript, error) {
+	if r.MigrationDirectory == "" {
+		// os.DirFS("") would read from the root directory.
+		return nil, ReadError{Path: r.MigrationDirectory, Err: fs.ErrInvalid}
+	}
 
-func (by ByName) Len() int           { return len(by) }
-func (by ByName) Less(i, j int) bool { return by[i].Name() < by[j].Name() }
-func (by ByName) Swap(i, j int)      { by[i], by[j] = by[j], by[i] }
+	scripts, err := MigrationReaderIOFS{FS: os.DirFS(r.MigrationDirectory)}.ReadScriptFiles()
+	var readError ReadError
+	if errors.As(err, &readError) {
+		readError.Path = filepath.Join(r.MigrationDirectory, readError.Path)
+		return nil, readError
+	}
+	return scripts, err
+}
+
+// MigrationReaderIOFS Migration reader for any file system, like the
+// directories embedded with go:embed or a fstest.MapFS.
+type MigrationReaderIOFS struct {
+	FS fs.FS
+	// The directory of the scripts on the file system, the root if
+	// empty.
+	Directory string
+}
 
 // ReadScriptFiles Read all found SQL scripts and return a structure
-// with all its content.
-func (r MigrationReaderFS) ReadScriptFiles() []database.SQLScript {
-	files := getAllScriptFiles(r.MigrationDirectory)
-
-	scripts := make([]database.SQLScript, len(files))
-	for index, file := range files {
-		content := getFileContent(r.MigrationDirectory, file)
-		scripts[index] = database.SQLScript{
-			Name:    file.Name(),
-			Content: content,
+// with all its content. Versioned scripts come first ordered by
+// version, followed by the repeatable scripts ordered by description.
+// Undo scripts are not returned, they are paired with the versioned
+// script with the same version.
+func (r MigrationReaderIOFS) ReadScriptFiles() ([]database.SQLScript, error) {
+	directory := r.Directory
+	if directory == "" {
+		directory = "."
+	}
+	files, err := getAllScriptFiles(r.FS, directory)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := []database.SQLScript{}
+	undoScripts := []database.SQLScript{}
+	for _, file := range files {
+		script, err := parseScriptName(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		script.Content, err = getFileContent(r.FS, directory, file)
+		if err != nil {
+			return nil, err
+		}
+		script.NoTransaction = hasNoTransactionDirective(script.Content)
+		if script.Type == database.SCRIPT_UNDO {
+			undoScripts = append(undoScripts, script)
+		} else {
+			scripts = append(scripts, script)
 		}
 	}
-	return scripts
+
+	sort.SliceStable(scripts, func(i, j int) bool {
+		return lessScript(scripts[i], scripts[j])
+	})
+	err = checkDuplicateVersions(scripts)
+	if err != nil {
+		return nil, err
+	}
+	err = pairUndoScripts(scripts, undoScripts)
+	if err != nil {
+		return nil, err
+	}
+	return scripts, nil
+}
+
+// pairUndoScripts Sets the undo script of every versioned script with
+// the same version, returns an error if an undo script has no versioned
+// script or if two undo scripts have the same version.
+func pairUndoScripts(scripts []database.SQLScript, undoScripts []database.SQLScript) error {
+	versioned := make(map[string]int, len(scripts))
+	for index, script := range scripts {
+		if script.Type == database.SCRIPT_VERSIONED {
+			versioned[script.Version.String()] = index
+		}
+	}
+
+	for index := range undoScripts {
+		undo := undoScripts[index]
+		scriptIndex, ok := versioned[undo.Version.String()]
+		if !ok {
+			return UndoWithoutScriptError{FileName: undo.Name}
+		}
+		if scripts[scriptIndex].Undo != nil {
+			return DuplicateVersionError{
+				Version:   undo.Version,
+				FileNames: []string{scripts[scriptIndex].Undo.Name, undo.Name},
+			}
+		}
+		scripts[scriptIndex].Undo = &undoScripts[index]
+	}
+	return nil
+}
+
+// lessScript Orders versioned scripts by version before all
+// repeatable scripts, which are ordered by description.
+func lessScript(left, right database.SQLScript) bool {
+	if left.Type != right.Type {
+		return left.Type == database.SCRIPT_VERSIONED
+	}
+	if left.Type == database.SCRIPT_REPEATABLE {
+		return left.Description < right.Description
+	}
+	return left.Version.Compare(right.Version) < 0
 }
 
 // getAllScriptFiles Get all the SQL scripts inside the migration
 // directory.
-func getAllScriptFiles(migrationDirectory string) []os.FileInfo {
-	files, err := ioutil.ReadDir(migrationDirectory)
+func getAllScriptFiles(fsys fs.FS, migrationDirectory string) ([]fs.DirEntry, error) {
+	files, err := fs.ReadDir(fsys, migrationDirectory)
 	if err != nil {
-		logrus.Fatal("Error reading migration directory.\n", err)
+		return nil, ReadError{Path: migrationDirectory, Err: err}
 	}
 
 	if len(files) == 0 {
 		logrus.Info("Empty directory, no migrations executed.")
-		return nil
+		return nil, nil
 	}
 
-	scripts := filterSqlFiles(files)
-
-	// Sort by file name so scripts are executed on order.
-	sort.Sort(ByName(scripts))
-	return scripts
+	return filterSqlFiles(files), nil
 }
 
 // filterSqlFiles Get all files with .sql extension
-func filterSqlFiles(files []os.FileInfo) []os.FileInfo {
-	scripts := []os.FileInfo{}
+func filterSqlFiles(files []fs.DirEntry) []fs.DirEntry {
+	scripts := []fs.DirEntry{}
 	for _, file := range files {
-		if strings.HasSuffix(file.Name(), ".sql") {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".sql") {
 			scripts = append(scripts, file)
 		}
 	}
 	return scripts
 }
 
-// getFileContent Reads the content from a given file and logs fatal
-// if the file is unreadable.
-func getFileContent(directory string, file os.FileInfo) string {
-	content, err := ioutil.ReadFile(directory + "/" + file.Name())
+// parseScriptName Parses the type, version and description from the
+// script name and returns a ScriptNameError if the name doesn't follow
+// the versioned, the repeatable or the undo pattern.
+func parseScriptName(name string) (database.SQLScript, error) {
+	if matches := REPEATABLE_SCRIPT_PATTERN.FindStringSubmatch(name); matches != nil {
+		return database.SQLScript{
+			Name:        name,
+			Type:        database.SCRIPT_REPEATABLE,
+			Description: strings.ReplaceAll(matches[1], "_", " "),
+		}, nil
+	}
+
+	scriptType := database.SCRIPT_VERSIONED
+	matches := VERSIONED_SCRIPT_PATTERN.FindStringSubmatch(name)
+	if matches == nil {
+		scriptType = database.SCRIPT_UNDO
+		matches = UNDO_SCRIPT_PATTERN.FindStringSubmatch(name)
+	}
+	if matches == nil {
+		return database.SQLScript{}, ScriptNameError{FileName: name}
+	}
+
+	version, err := database.ParseVersion(matches[1])
+	if err != nil {
+		return database.SQLScript{}, ScriptNameError{FileName: name, Err: err}
+	}
+	return database.SQLScript{
+		Name:        name,
+		Type:        scriptType,
+		Version:     version,
+		Description: strings.ReplaceAll(matches[2], "_", " "),
+	}, nil
+}
+
+// hasNoTransactionDirective Checks if the comments at the beginning of
+// the script, before the first statement, have the no transaction
+// directive.
+func hasNoTransactionDirective(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "--") {
+			return false
+		}
+		if strings.TrimSpace(strings.TrimPrefix(line, "--")) == NO_TRANSACTION_DIRECTIVE {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDuplicateVersions Returns a DuplicateVersionError if two
+// versioned scripts have the same version, the scripts must be sorted by
+// version.
+func checkDuplicateVersions(scripts []database.SQLScript) error {
+	for index := 1; index < len(scripts); index++ {
+		previous, current := scripts[index-1], scripts[index]
+		if current.Type != database.SCRIPT_VERSIONED {
+			break
+		}
+		if previous.Version.Compare(current.Version) == 0 {
+			return DuplicateVersionError{
+				Version:   current.Version,
+				FileNames: []string{previous.Name, current.Name},
+			}
+		}
+	}
+	return nil
+}
+
+// getFileContent Reads the content from a given file and returns a
+// ReadError if the file is unreadable.
+func getFileContent(fsys fs.FS, directory string, file fs.DirEntry) (string, error) {
+	filePath := path.Join(directory, file.Name())
+	content, err := fs.ReadFile(fsys, filePath)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"file_name": file.Name(),
-		}).Fatal("File not found.\n", err)
+		return "", ReadError{Path: filePath, Err: err}
 	}
-	return string(content)
+	return string(content), nil
 }
@@ -1,26 +1,27 @@
 package reader
 
 import (
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"testing"
+	"testing/fstest"
 
-	"github.com/sirupsen/logrus"
+	"github.com/eaneto/grotto/pkg/database"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestReadNonExistentDirectoryShouldLogFatal(t *testing.T) {
+func TestReadNonExistentDirectoryShouldReturnReadError(t *testing.T) {
 	reader := MigrationReaderFS{
 		MigrationDirectory: "non_existent_directory",
 	}
 
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-	var fatal bool
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
+	scripts, err := reader.ReadScriptFiles()
 
-	reader.ReadScriptFiles()
-
-	assert.True(t, fatal)
+	var readError ReadError
+	assert.ErrorAs(t, err, &readError)
+	assert.Equal(t, "non_existent_directory", readError.Path)
+	assert.Nil(t, scripts)
 }
 
 func TestReadEmptyDirectoryShouldReturnEmptySlice(t *testing.T) {
@@ -32,8 +33,9 @@ func TestReadEmptyDirectoryShouldReturnEmptySlice(t *testing.T) {
 		MigrationDirectory: dir,
 	}
 
-	scripts := reader.ReadScriptFiles()
+	scripts, err := reader.ReadScriptFiles()
 
+	assert.Nil(t, err)
 	assert.Empty(t, scripts)
 }
 
@@ -48,8 +50,9 @@ func TestReadDirectoryWithFilesButNoSqlFilesShouldReturnEmptySlice(t *testing.T)
 		MigrationDirectory: dir,
 	}
 
-	scripts := reader.ReadScriptFiles()
+	scripts, err := reader.ReadScriptFiles()
 
+	assert.Nil(t, err)
 	assert.Empty(t, scripts)
 }
 
@@ -57,7 +60,7 @@ func TestReadDirectoryWithOneSqlFileShouldReturnListWithFileContentAndName(t *te
 	dir := "reader_test"
 	os.RemoveAll(dir)
 	os.Mkdir(dir, os.ModePerm)
-	filename := "file_name.sql"
+	filename := "V1__file_name.sql"
 	content := []byte("data")
 	ioutil.WriteFile(dir+"/"+filename, content, os.ModePerm)
 
@@ -65,18 +68,21 @@ func TestReadDirectoryWithOneSqlFileShouldReturnListWithFileContentAndName(t *te
 		MigrationDirectory: dir,
 	}
 
-	scripts := reader.ReadScriptFiles()
+	scripts, err := reader.ReadScriptFiles()
 
+	assert.Nil(t, err)
 	assert.NotEmpty(t, scripts)
 	assert.Equal(t, filename, scripts[0].Name)
 	assert.Equal(t, string(content), scripts[0].Content)
+	assert.Equal(t, database.Version{1}, scripts[0].Version)
+	assert.Equal(t, "file name", scripts[0].Description)
 }
 
-func TestReadDirectoryWithOneSqlFileWithOutPermissionShouldLogFatal(t *testing.T) {
+func TestReadDirectoryWithOneSqlFileWithOutPermissionShouldReturnReadError(t *testing.T) {
 	dir := "reader_test"
 	os.RemoveAll(dir)
 	os.Mkdir(dir, os.ModePerm)
-	filename := "file_name.sql"
+	filename := "V1__file_name.sql"
 	content := []byte("data")
 	ioutil.WriteFile(dir+"/"+filename, content, 0000)
 
@@ -84,13 +90,12 @@ func TestReadDirectoryWithOneSqlFileWithOutPermissionShouldLogFatal(t *testing.T
 		MigrationDirectory: dir,
 	}
 
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-	var fatal bool
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
-
-	reader.ReadScriptFiles()
+	scripts, err := reader.ReadScriptFiles()
 
-	assert.True(t, fatal)
+	var readError ReadError
+	assert.ErrorAs(t, err, &readError)
+	assert.Equal(t, dir+"/"+filename, readError.Path)
+	assert.Nil(t, scripts)
 }
 
 func TestReadDirectoryWithMultipleSqlFilesShouldReturnListWithAllFilesButNoneThatAreNotSql(t *testing.T) {
@@ -98,8 +103,8 @@ func TestReadDirectoryWithMultipleSqlFilesShouldReturnListWithAllFilesButNoneTha
 	os.RemoveAll(dir)
 	os.Mkdir(dir, os.ModePerm)
 	files := []string{
-		"file_name.sql",
-		"file_2.sql",
+		"V10__file_name.sql",
+		"V2__file.sql",
 		"not_sql.txt",
 	}
 	contents := [][]byte{
@@ -117,17 +122,248 @@ func TestReadDirectoryWithMultipleSqlFilesShouldReturnListWithAllFilesButNoneTha
 		MigrationDirectory: dir,
 	}
 
-	scripts := reader.ReadScriptFiles()
+	scripts, err := reader.ReadScriptFiles()
 
+	assert.Nil(t, err)
 	assert.NotEmpty(t, scripts)
 	assert.Equal(t, expectedScriptsSize, len(scripts))
 
-	// one of the created scripts has a number on it, so it will come
-	// first, it's important to validate that this script is the first
-	// one returned.
+	// scripts are ordered by their numeric version, so V2 must come
+	// before V10 even though it doesn't by name.
 	assert.Equal(t, files[1], scripts[0].Name)
 	assert.Equal(t, string(contents[1]), scripts[0].Content)
 
 	assert.Equal(t, files[0], scripts[1].Name)
 	assert.Equal(t, string(contents[0]), scripts[1].Content)
 }
+
+func TestReadDirectoryWithDottedVersionsShouldOrderByVersion(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	files := []string{
+		"V1.10__third.sql",
+		"V1_2__second.sql",
+		"V1.2.1__between.sql",
+		"V1__first.sql",
+	}
+	for _, file := range files {
+		ioutil.WriteFile(dir+"/"+file, []byte("data"), os.ModePerm)
+	}
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	names := []string{}
+	for _, script := range scripts {
+		names = append(names, script.Name)
+	}
+	assert.Equal(t, []string{
+		"V1__first.sql",
+		"V1_2__second.sql",
+		"V1.2.1__between.sql",
+		"V1.10__third.sql",
+	}, names)
+}
+
+func TestReadDirectoryWithInvalidScriptNameShouldReturnScriptNameError(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	ioutil.WriteFile(dir+"/V1_syntax_error.sql", []byte("data"), os.ModePerm)
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Equal(t, ScriptNameError{FileName: "V1_syntax_error.sql"}, err)
+	assert.Nil(t, scripts)
+}
+
+func TestReadDirectoryWithDuplicateVersionsShouldReturnDuplicateVersionError(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	ioutil.WriteFile(dir+"/V1__first.sql", []byte("data"), os.ModePerm)
+	ioutil.WriteFile(dir+"/V1.0__same_version.sql", []byte("data"), os.ModePerm)
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Equal(t, DuplicateVersionError{
+		Version:   database.Version{1},
+		FileNames: []string{"V1.0__same_version.sql", "V1__first.sql"},
+	}, err)
+	assert.Nil(t, scripts)
+}
+
+func TestReadDirectoryWithRepeatableScriptsShouldReturnThemAfterVersionedScripts(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	files := []string{
+		"R__b_views.sql",
+		"V2__second.sql",
+		"R__a_functions.sql",
+		"V1__first.sql",
+	}
+	for _, file := range files {
+		ioutil.WriteFile(dir+"/"+file, []byte("data"), os.ModePerm)
+	}
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	names := []string{}
+	for _, script := range scripts {
+		names = append(names, script.Name)
+	}
+	assert.Equal(t, []string{
+		"V1__first.sql",
+		"V2__second.sql",
+		"R__a_functions.sql",
+		"R__b_views.sql",
+	}, names)
+	assert.Equal(t, database.SCRIPT_REPEATABLE, scripts[2].Type)
+	assert.Equal(t, "a functions", scripts[2].Description)
+	assert.Nil(t, scripts[2].Version)
+}
+
+func TestReadScriptWithNoTransactionHeaderShouldMarkScriptAsNoTransaction(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	ioutil.WriteFile(dir+"/V1__index.sql",
+		[]byte("-- Creates the index without locking the table\n--grotto:no-transaction\nCREATE INDEX CONCURRENTLY idx ON users (id);"),
+		os.ModePerm)
+	ioutil.WriteFile(dir+"/V2__table.sql",
+		[]byte("CREATE TABLE other (id int);\n-- grotto:no-transaction"),
+		os.ModePerm)
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.True(t, scripts[0].NoTransaction)
+	assert.False(t, scripts[1].NoTransaction)
+}
+
+func TestReadDirectoryWithUndoScriptsShouldPairThemWithVersionedScripts(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	ioutil.WriteFile(dir+"/V1__create_users.sql", []byte("CREATE TABLE users (id int);"), os.ModePerm)
+	ioutil.WriteFile(dir+"/U1__drop_users.sql", []byte("DROP TABLE users;"), os.ModePerm)
+	ioutil.WriteFile(dir+"/V1.1__seed.sql", []byte("INSERT INTO users VALUES (1);"), os.ModePerm)
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(scripts))
+	assert.Equal(t, "V1__create_users.sql", scripts[0].Name)
+	assert.Equal(t, &database.SQLScript{
+		Name:        "U1__drop_users.sql",
+		Type:        database.SCRIPT_UNDO,
+		Version:     database.Version{1},
+		Description: "drop users",
+		Content:     "DROP TABLE users;",
+	}, scripts[0].Undo)
+	assert.Nil(t, scripts[1].Undo)
+}
+
+func TestReadDirectoryWithUndoScriptWithoutVersionedScriptShouldReturnError(t *testing.T) {
+	dir := "reader_test"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, os.ModePerm)
+	ioutil.WriteFile(dir+"/V1__first.sql", []byte("data"), os.ModePerm)
+	ioutil.WriteFile(dir+"/U2__unknown.sql", []byte("data"), os.ModePerm)
+
+	reader := MigrationReaderFS{
+		MigrationDirectory: dir,
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Equal(t, UndoWithoutScriptError{FileName: "U2__unknown.sql"}, err)
+	assert.Nil(t, scripts)
+}
+
+func TestReadFileSystemShouldReadTheScriptsOfTheDirectory(t *testing.T) {
+	reader := MigrationReaderIOFS{
+		FS: fstest.MapFS{
+			"migrations/V2__second.sql":      {Data: []byte("second")},
+			"migrations/V1__first.sql":       {Data: []byte("first")},
+			"migrations/U2__undo_second.sql": {Data: []byte("undo")},
+			"migrations/nested/V3__x.sql":    {Data: []byte("nested")},
+			"migrations/README.md":           {Data: []byte("docs")},
+			"V9__outside.sql":                {Data: []byte("outside")},
+		},
+		Directory: "migrations",
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(scripts))
+	assert.Equal(t, "V1__first.sql", scripts[0].Name)
+	assert.Equal(t, "first", scripts[0].Content)
+	assert.Equal(t, "V2__second.sql", scripts[1].Name)
+	assert.Equal(t, "undo", scripts[1].Undo.Content)
+}
+
+func TestReadFileSystemWithoutDirectoryShouldReadTheRoot(t *testing.T) {
+	reader := MigrationReaderIOFS{
+		FS: fstest.MapFS{
+			"V1__first.sql": {Data: []byte("first")},
+		},
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "V1__first.sql", scripts[0].Name)
+}
+
+func TestReadFileSystemWithNonExistentDirectoryShouldReturnReadError(t *testing.T) {
+	reader := MigrationReaderIOFS{
+		FS:        fstest.MapFS{},
+		Directory: "migrations",
+	}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	var readError ReadError
+	assert.ErrorAs(t, err, &readError)
+	assert.Equal(t, "migrations", readError.Path)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Nil(t, scripts)
+}
+
+func TestReadWithoutMigrationDirectoryShouldReturnReadError(t *testing.T) {
+	reader := MigrationReaderFS{}
+
+	scripts, err := reader.ReadScriptFiles()
+
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+	assert.Nil(t, scripts)
+}
@@ -3,7 +3,9 @@ package registry
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/eaneto/grotto/internal/session"
 	"github.com/eaneto/grotto/pkg/database"
 	"github.com/sirupsen/logrus"
 )
@@ -15,43 +17,75 @@ const MIGRATION_TABLE_NAME = "grotto_migration"
 // This table is responsible to store the scripts executed so they won't be
 // executed multiple times.
 // The table stores a sequencial id, the name of the script which was executed
-// and the date it was created. The script name is a unique field.
+// and the date it was created. The script name is a unique field. This is the
+// first version of the table, every other column is added by the upgrades in
+// SCHEMA_UPGRADES.
 const DEFAULT_MIGRATION_SCRIPT = `create table if not exists ` +
 	MIGRATION_TABLE_NAME +
 	`(id bigint generated always as identity primary key,
 script_name varchar constraint uk_script_name unique not null,
 created_at timestamp not null default now());`
 
+// BASELINE_SCRIPT_NAME The script name of the baseline marker on the
+// migration table.
+const BASELINE_SCRIPT_NAME = "<< Grotto Baseline >>"
+
+// SCHEMA_IS_EMPTY_QUERY Checks if the current schema has no relation,
+// like tables, views or sequences.
+const SCHEMA_IS_EMPTY_QUERY = `SELECT NOT EXISTS (SELECT 1 FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = current_schema())`
+
 // MigrationRegister Base interface for the migration registration.
 type MigrationRegister interface {
 	CreateMigrationTable() error
 	IsScriptAlreadyExecuted(script database.SQLScript) (bool, error)
-	MarkScriptAsExecuted(script database.SQLScript) error
+	MarkScriptAsExecuted(script database.SQLScript, executionTime time.Duration) error
+	MarkScriptAsFailed(script database.SQLScript, executionTime time.Duration) error
+	MigrationTableExists() (bool, error)
+	UpgradeMigrationTable() error
+	ExecutedScripts() ([]database.MigrationRecord, error)
+	RemoveScript(scriptName string) error
+	UpdateChecksum(scriptName string, checksum string) error
+	MarkScriptAsDeleted(scriptName string) error
+	InsertBaseline(version database.Version, description string) error
+	IsSchemaEmpty() (bool, error)
 }
 
 // MigrationRegisterSQL Migration register for SQL.
 type MigrationRegisterSQL struct {
-	// Transaction that the migration should be registered.
-	Tx *sql.Tx
+	// Transaction or session that the migration should be registered.
+	Tx session.Queryer
 }
 
-// CreateMigrationTable Executes the SQL script that creates the migration table.
+// CreateMigrationTable Executes the SQL script that creates the migration table
+// and upgrades it to the latest schema version.
 func (m MigrationRegisterSQL) CreateMigrationTable() error {
-	_, err := m.Tx.Exec(DEFAULT_MIGRATION_SCRIPT)
+	exists, err := m.MigrationTableExists()
+	if err != nil {
+		return err
+	}
+	_, err = m.Tx.Exec(DEFAULT_MIGRATION_SCRIPT)
 	if err != nil {
 		logrus.Error("Error creating basic migration table.\n", err)
 		return err
 	}
-	return nil
+	return m.upgradeMigrationTable(!exists)
 }
 
 // IsScriptAlreadyExecuted Check if the script was alreayd executed by counting the rows
-// in the migration table with the script name.
+// in the migration table with the script name. Repeatable scripts are only
+// considered executed if the last execution has the same checksum.
 func (m MigrationRegisterSQL) IsScriptAlreadyExecuted(script database.SQLScript) (bool, error) {
-	query := fmt.Sprintf("SELECT count(id) FROM %s WHERE script_name = '%s'",
-		MIGRATION_TABLE_NAME, script.Name)
+	query := fmt.Sprintf("SELECT count(id) FROM %s WHERE script_name = $1 AND success",
+		MIGRATION_TABLE_NAME)
+	args := []interface{}{script.Name}
+	if script.Type == database.SCRIPT_REPEATABLE {
+		query += " AND checksum = $2"
+		args = append(args, script.Checksum())
+	}
 	var count int
-	err := m.Tx.QueryRow(query).Scan(&count)
+	err := m.Tx.QueryRow(query, args...).Scan(&count)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"script_name": script.Name,
@@ -61,11 +95,34 @@ func (m MigrationRegisterSQL) IsScriptAlreadyExecuted(script database.SQLScript)
 	return count > 0, nil
 }
 
-// MarkScriptAsExecuted Insert the script name on the migration table.
-func (m MigrationRegisterSQL) MarkScriptAsExecuted(script database.SQLScript) error {
-	query := fmt.Sprintf("INSERT INTO %s (script_name) VALUES ('%s')",
-		MIGRATION_TABLE_NAME, script.Name)
-	_, err := m.Tx.Exec(query)
+// MarkScriptAsExecuted Insert the script with its version, description, type,
+// checksum and execution time on the migration table. Scripts already on the
+// table, repeatable or failed scripts, have their row updated with the new
+// execution.
+func (m MigrationRegisterSQL) MarkScriptAsExecuted(script database.SQLScript, executionTime time.Duration) error {
+	return m.registerExecution(script, executionTime, true)
+}
+
+// MarkScriptAsFailed Insert the script as failed on the migration table, only
+// used for scripts executed outside a transaction, which may be partially
+// applied. Failed scripts are executed again on the next migration.
+func (m MigrationRegisterSQL) MarkScriptAsFailed(script database.SQLScript, executionTime time.Duration) error {
+	return m.registerExecution(script, executionTime, false)
+}
+
+// registerExecution Insert or update the script execution on the migration
+// table.
+func (m MigrationRegisterSQL) registerExecution(script database.SQLScript, executionTime time.Duration, success bool) error {
+	query := fmt.Sprintf(`INSERT INTO %s
+(script_name, version, description, type, checksum, execution_time_ms, success)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (script_name) DO UPDATE SET checksum = excluded.checksum,
+execution_time_ms = excluded.execution_time_ms, success = excluded.success,
+installed_by = current_user, created_at = now()`,
+		MIGRATION_TABLE_NAME)
+	_, err := m.Tx.Exec(query, script.Name, nullableVersion(script.Version),
+		script.Description, string(script.Type), script.Checksum(),
+		executionTime.Milliseconds(), success)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"script_name": script.Name,
@@ -74,3 +131,157 @@ func (m MigrationRegisterSQL) MarkScriptAsExecuted(script database.SQLScript) er
 	}
 	return nil
 }
+
+// MigrationTableExists Check if the migration table was already
+// created in the current schema.
+func (m MigrationRegisterSQL) MigrationTableExists() (bool, error) {
+	query := fmt.Sprintf("SELECT to_regclass('%s') IS NOT NULL", MIGRATION_TABLE_NAME)
+	var exists bool
+	err := m.Tx.QueryRow(query).Scan(&exists)
+	if err != nil {
+		logrus.Error("Error checking if the migration table exists.\n", err)
+		return false, err
+	}
+	return exists, nil
+}
+
+// EXECUTED_SCRIPTS_QUERY Lists the executed scripts of a migration table
+// on the latest schema version.
+var EXECUTED_SCRIPTS_QUERY = `SELECT script_name, coalesce(version, ''), coalesce(description, ''),
+type, coalesce(checksum, ''), installed_by, created_at, coalesce(execution_time_ms, 0), success
+FROM ` + MIGRATION_TABLE_NAME + ` ORDER BY id`
+
+// FIRST_VERSION_EXECUTED_SCRIPTS_QUERY Lists the executed scripts of a
+// migration table on the first schema version, the columns added by the
+// upgrades are filled like the upgrades fill them.
+var FIRST_VERSION_EXECUTED_SCRIPTS_QUERY = `SELECT script_name,
+coalesce(` + SCRIPT_VERSION_EXPRESSION + `, ''),
+coalesce(` + SCRIPT_DESCRIPTION_EXPRESSION + `, ''),
+` + SCRIPT_TYPE_EXPRESSION + `, '', current_user::varchar, created_at, 0, true
+FROM ` + MIGRATION_TABLE_NAME + ` ORDER BY id`
+
+// ExecutedScripts List all the scripts registered on the migration
+// table in the order they were executed. A migration table on the first
+// schema version is read without being upgraded.
+func (m MigrationRegisterSQL) ExecutedScripts() ([]database.MigrationRecord, error) {
+	schemaVersion, err := m.storedSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	query := EXECUTED_SCRIPTS_QUERY
+	if schemaVersion == 1 {
+		query = FIRST_VERSION_EXECUTED_SCRIPTS_QUERY
+	}
+	rows, err := m.Tx.Query(query)
+	if err != nil {
+		logrus.Error("Error listing the executed scripts.\n", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []database.MigrationRecord{}
+	for rows.Next() {
+		var record database.MigrationRecord
+		var version, scriptType string
+		var executionTime int64
+		err = rows.Scan(&record.ScriptName, &version, &record.Description, &scriptType,
+			&record.Checksum, &record.InstalledBy, &record.CreatedAt, &executionTime,
+			&record.Success)
+		if err != nil {
+			logrus.Error("Error reading the executed scripts.\n", err)
+			return nil, err
+		}
+		if version != "" {
+			record.Version, err = database.ParseVersion(version)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"script_name": record.ScriptName,
+				}).Error("Invalid version on the migration table.\n", err)
+				return nil, err
+			}
+		}
+		record.Type = database.ScriptType(scriptType)
+		record.ExecutionTime = time.Duration(executionTime) * time.Millisecond
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// RemoveScript Delete the script from the migration table, so it's no
+// longer considered as executed.
+func (m MigrationRegisterSQL) RemoveScript(scriptName string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE script_name = $1", MIGRATION_TABLE_NAME)
+	_, err := m.Tx.Exec(query, scriptName)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"script_name": scriptName,
+		}).Error("Error removing the script from the migration table.\n", err)
+		return err
+	}
+	return nil
+}
+
+// UpdateChecksum Replace the stored checksum of the script, used to
+// realign it with the script on the migration directory.
+func (m MigrationRegisterSQL) UpdateChecksum(scriptName string, checksum string) error {
+	query := fmt.Sprintf("UPDATE %s SET checksum = $1 WHERE script_name = $2", MIGRATION_TABLE_NAME)
+	_, err := m.Tx.Exec(query, checksum, scriptName)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"script_name": scriptName,
+		}).Error("Error updating the checksum of the script.\n", err)
+		return err
+	}
+	return nil
+}
+
+// MarkScriptAsDeleted Change the type of the script to deleted, the
+// script is kept on the migration table but is no longer expected on
+// the migration directory.
+func (m MigrationRegisterSQL) MarkScriptAsDeleted(scriptName string) error {
+	query := fmt.Sprintf("UPDATE %s SET type = $1 WHERE script_name = $2", MIGRATION_TABLE_NAME)
+	_, err := m.Tx.Exec(query, string(database.SCRIPT_DELETED), scriptName)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"script_name": scriptName,
+		}).Error("Error marking the script as deleted.\n", err)
+		return err
+	}
+	return nil
+}
+
+// InsertBaseline Insert the baseline marker with the given version on
+// the migration table.
+func (m MigrationRegisterSQL) InsertBaseline(version database.Version, description string) error {
+	query := fmt.Sprintf(`INSERT INTO %s
+(script_name, version, description, type, execution_time_ms, success)
+VALUES ($1, $2, $3, $4, 0, true)`, MIGRATION_TABLE_NAME)
+	_, err := m.Tx.Exec(query, BASELINE_SCRIPT_NAME, nullableVersion(version),
+		description, string(database.SCRIPT_BASELINE))
+	if err != nil {
+		logrus.Error("Error inserting the baseline on the migration table.\n", err)
+		return err
+	}
+	return nil
+}
+
+// IsSchemaEmpty Check if the current schema has no tables, views,
+// sequences or any other relation.
+func (m MigrationRegisterSQL) IsSchemaEmpty() (bool, error) {
+	var empty bool
+	err := m.Tx.QueryRow(SCHEMA_IS_EMPTY_QUERY).Scan(&empty)
+	if err != nil {
+		logrus.Error("Error checking if the schema is empty.\n", err)
+		return false, err
+	}
+	return empty, nil
+}
+
+// nullableVersion Converts the version to its string representation,
+// scripts without version are stored as null.
+func nullableVersion(version database.Version) sql.NullString {
+	if version == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: version.String(), Valid: true}
+}
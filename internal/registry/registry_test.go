@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/eaneto/grotto/pkg/database"
@@ -33,6 +34,7 @@ func TestCreatingDefaultMigrationTableWithErrorExecutingScriptShouldReturnError(
 		Tx: tx,
 	}
 	expectedError := errors.New("Error creating table")
+	mock.ExpectQuery("to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectExec(MIGRATION_TABLE_NAME).WillReturnError(expectedError)
 
 	actualError := registry.CreateMigrationTable()
@@ -51,7 +53,34 @@ func TestCreatingDefaultMigrationTableWithSuccessShouldReturnNilError(t *testing
 	registry := MigrationRegisterSQL{
 		Tx: tx,
 	}
+	mock.ExpectQuery("to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 	mock.ExpectExec(MIGRATION_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SCHEMA_VERSION))
+
+	actualError := registry.CreateMigrationTable()
+
+	assert.Nil(t, actualError)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCreatingDroppedMigrationTableShouldUpgradeItAgain(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{
+		Tx: tx,
+	}
+	mock.ExpectQuery("to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(MIGRATION_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SCHEMA_VERSION))
+	mock.ExpectExec("alter table " + MIGRATION_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO " + SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 1))
 
 	actualError := registry.CreateMigrationTable()
 
@@ -72,7 +101,8 @@ func TestSearchForMigrationNotExecutedShouldReturnIsScriptNotExecuted(t *testing
 		Name:    "script_name.sql",
 		Content: "Script content",
 	}
-	mock.ExpectQuery(regexp.QuoteMeta(script.Name)).
+	mock.ExpectQuery(regexp.QuoteMeta("script_name = $1 AND success")).
+		WithArgs(script.Name).
 		WillReturnRows(sqlmock.NewRows([]string{"count(id)"}).AddRow(0))
 
 	isAlreadyExecuted, err := registry.IsScriptAlreadyExecuted(script)
@@ -95,7 +125,8 @@ func TestSearchForMigrationExecutedShouldReturnIsScriptExecuted(t *testing.T) {
 		Name:    "script_name.sql",
 		Content: "Script content",
 	}
-	mock.ExpectQuery(regexp.QuoteMeta(script.Name)).
+	mock.ExpectQuery(regexp.QuoteMeta("script_name = $1 AND success")).
+		WithArgs(script.Name).
 		WillReturnRows(sqlmock.NewRows([]string{"count(id)"}).AddRow(1))
 
 	isAlreadyExecuted, err := registry.IsScriptAlreadyExecuted(script)
@@ -119,7 +150,8 @@ func TestSearchForMigrationExecutedWithErrorOnQueryShouldReturnError(t *testing.
 		Content: "Script content",
 	}
 	expectedError := errors.New("Error querying table.")
-	mock.ExpectQuery(regexp.QuoteMeta(script.Name)).
+	mock.ExpectQuery(regexp.QuoteMeta("script_name = $1 AND success")).
+		WithArgs(script.Name).
 		WillReturnError(expectedError)
 
 	isAlreadyExecuted, actualError := registry.IsScriptAlreadyExecuted(script)
@@ -130,6 +162,73 @@ func TestSearchForMigrationExecutedWithErrorOnQueryShouldReturnError(t *testing.
 	assertDatabaseExpectations(t, mock)
 }
 
+func TestSearchForRepeatableMigrationShouldFilterByChecksum(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	script := database.SQLScript{
+		Name:    "R__views.sql",
+		Type:    database.SCRIPT_REPEATABLE,
+		Content: "Script content",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("script_name = $1 AND success AND checksum = $2")).
+		WithArgs(script.Name, script.Checksum()).
+		WillReturnRows(sqlmock.NewRows([]string{"count(id)"}).AddRow(0))
+
+	isAlreadyExecuted, err := registry.IsScriptAlreadyExecuted(script)
+
+	assert.Nil(t, err)
+	assert.False(t, isAlreadyExecuted)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestSearchForMigrationWithQuoteOnNameShouldPassTheNameAsArgument(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	script := database.SQLScript{
+		Name:    "V1__o'neil.sql",
+		Content: "Script content",
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("script_name = $1 AND success")).
+		WithArgs(script.Name).
+		WillReturnRows(sqlmock.NewRows([]string{"count(id)"}).AddRow(1))
+
+	isAlreadyExecuted, err := registry.IsScriptAlreadyExecuted(script)
+
+	assert.Nil(t, err)
+	assert.True(t, isAlreadyExecuted)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestMarkScriptAsExecutedShouldStoreChecksum(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	script := database.SQLScript{
+		Name:    "R__views.sql",
+		Type:    database.SCRIPT_REPEATABLE,
+		Content: "Script content",
+	}
+	mock.ExpectExec("INSERT INTO "+MIGRATION_TABLE_NAME+".*ON CONFLICT").
+		WithArgs(script.Name, nil, script.Description, "repeatable", script.Checksum(), int64(1500), true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := registry.MarkScriptAsExecuted(script, 1500*time.Millisecond)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
 func TestMarkScriptAsExecutedWithSuccessShouldNotReturnError(t *testing.T) {
 	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
 	defer db.Close()
@@ -145,7 +244,29 @@ func TestMarkScriptAsExecutedWithSuccessShouldNotReturnError(t *testing.T) {
 	mock.ExpectExec(regex).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
-	err := registry.MarkScriptAsExecuted(script)
+	err := registry.MarkScriptAsExecuted(script, 0)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestMarkScriptAsFailedShouldStoreUnsuccessfulExecution(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	script := database.SQLScript{
+		Name:        "V1__index.sql",
+		Type:        database.SCRIPT_VERSIONED,
+		Version:     database.Version{1},
+		Description: "index",
+		Content:     "CREATE INDEX CONCURRENTLY idx ON users (id)",
+	}
+	mock.ExpectExec("INSERT INTO "+MIGRATION_TABLE_NAME).
+		WithArgs(script.Name, "1", "index", "versioned", script.Checksum(), int64(10), false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := registry.MarkScriptAsFailed(script, 10*time.Millisecond)
 
 	assert.Nil(t, err)
 	assertDatabaseExpectations(t, mock)
@@ -167,15 +288,255 @@ func TestMarkScriptAsExecutedWithErrorShouldReturnError(t *testing.T) {
 	mock.ExpectExec(regex).
 		WillReturnError(expectedError)
 
-	actualError := registry.MarkScriptAsExecuted(script)
+	actualError := registry.MarkScriptAsExecuted(script, 0)
 
 	assert.NotNil(t, actualError)
 	assert.Equal(t, expectedError, actualError)
 	assertDatabaseExpectations(t, mock)
 }
 
+func TestMigrationTableExistsShouldReturnQueryResult(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + MIGRATION_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	exists, err := registry.MigrationTableExists()
+
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestMigrationTableExistsWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	expectedError := errors.New("Error querying catalog")
+	mock.ExpectQuery("to_regclass").WillReturnError(expectedError)
+
+	exists, actualError := registry.MigrationTableExists()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.False(t, exists)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestExecutedScriptsShouldReturnAllRowsInOrder(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	now := time.Now()
+	columns := []string{"script_name", "version", "description", "type", "checksum",
+		"installed_by", "created_at", "execution_time_ms", "success"}
+	expectSchemaVersion(mock, SCHEMA_VERSION)
+	mock.ExpectQuery(regexp.QuoteMeta(EXECUTED_SCRIPTS_QUERY)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("V1__first.sql", "1", "first", "versioned", "abc", "user", now, 20, true).
+			AddRow("R__second.sql", "", "second", "repeatable", "", "user", now, 0, false))
+
+	records, err := registry.ExecutedScripts()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []database.MigrationRecord{
+		{
+			ScriptName:    "V1__first.sql",
+			Version:       database.Version{1},
+			Description:   "first",
+			Type:          database.SCRIPT_VERSIONED,
+			Checksum:      "abc",
+			InstalledBy:   "user",
+			CreatedAt:     now,
+			ExecutionTime: 20 * time.Millisecond,
+			Success:       true,
+		},
+		{
+			ScriptName:  "R__second.sql",
+			Description: "second",
+			Type:        database.SCRIPT_REPEATABLE,
+			InstalledBy: "user",
+			CreatedAt:   now,
+		},
+	}, records)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestExecutedScriptsOnFirstVersionShouldParseTheScriptNames(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + SCHEMA_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta(FIRST_VERSION_EXECUTED_SCRIPTS_QUERY)).
+		WillReturnRows(sqlmock.NewRows([]string{"script_name", "version", "description", "type", "checksum",
+			"installed_by", "created_at", "execution_time_ms", "success"}).
+			AddRow("V1_1__first_table.sql", "1.1", "first table", "versioned", "", "user", now, 0, true))
+
+	records, err := registry.ExecutedScripts()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []database.MigrationRecord{
+		{
+			ScriptName:  "V1_1__first_table.sql",
+			Version:     database.Version{1, 1},
+			Description: "first table",
+			Type:        database.SCRIPT_VERSIONED,
+			InstalledBy: "user",
+			CreatedAt:   now,
+			Success:     true,
+		},
+	}, records)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestExecutedScriptsWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	expectedError := errors.New("Error querying table")
+	expectSchemaVersion(mock, SCHEMA_VERSION)
+	mock.ExpectQuery("SELECT script_name, .* FROM " + MIGRATION_TABLE_NAME).WillReturnError(expectedError)
+
+	records, actualError := registry.ExecutedScripts()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.Nil(t, records)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestRemoveScriptShouldDeleteByScriptName(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectExec("DELETE FROM " + MIGRATION_TABLE_NAME).
+		WithArgs("script_name.sql").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := registry.RemoveScript("script_name.sql")
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUpdateChecksumShouldUpdateByScriptName(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	mock.ExpectExec("UPDATE "+MIGRATION_TABLE_NAME+" SET checksum").
+		WithArgs("new_checksum", "V1__first.sql").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := registry.UpdateChecksum("V1__first.sql", "new_checksum")
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestMarkScriptAsDeletedShouldChangeTheType(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	mock.ExpectExec("UPDATE "+MIGRATION_TABLE_NAME+" SET type").
+		WithArgs("deleted", "V1__first.sql").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := registry.MarkScriptAsDeleted("V1__first.sql")
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestMarkScriptAsDeletedWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	expectedError := errors.New("connection closed")
+	mock.ExpectExec("UPDATE " + MIGRATION_TABLE_NAME).WillReturnError(expectedError)
+
+	err := registry.MarkScriptAsDeleted("V1__first.sql")
+
+	assert.Equal(t, expectedError, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestInsertBaselineShouldInsertTheBaselineMarker(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	mock.ExpectExec("INSERT INTO "+MIGRATION_TABLE_NAME).
+		WithArgs(BASELINE_SCRIPT_NAME, "40", "legacy", "baseline").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err := registry.InsertBaseline(database.Version{40}, "legacy")
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestInsertBaselineWithErrorShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	expectedError := errors.New("duplicate key value violates unique constraint")
+	mock.ExpectExec("INSERT INTO " + MIGRATION_TABLE_NAME).WillReturnError(expectedError)
+
+	err := registry.InsertBaseline(database.Version{1}, "legacy")
+
+	assert.Equal(t, expectedError, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestIsSchemaEmptyShouldReturnIfTheSchemaHasRelations(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+
+	registry := MigrationRegisterSQL{db}
+	mock.ExpectQuery("pg_class").
+		WillReturnRows(sqlmock.NewRows([]string{"empty"}).AddRow(false))
+
+	empty, err := registry.IsSchemaEmpty()
+
+	assert.Nil(t, err)
+	assert.False(t, empty)
+	assertDatabaseExpectations(t, mock)
+}
+
 func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Not all expectation were met: %s", err)
 	}
 }
+
+// expectSchemaVersion Expects the schema version to be read without
+// creating the schema table.
+func expectSchemaVersion(mock sqlmock.Sqlmock, version int) {
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + SCHEMA_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT coalesce(max(version), 1) FROM " + SCHEMA_TABLE_NAME)).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(version))
+}
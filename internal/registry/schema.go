@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SCHEMA_TABLE_NAME The name of the table that stores the schema version
+// of the migration table itself.
+const SCHEMA_TABLE_NAME = "grotto_migration_schema"
+
+// DEFAULT_SCHEMA_SCRIPT Creates the table with the schema version of the
+// migration table, it has a single row with the current version.
+const DEFAULT_SCHEMA_SCRIPT = `create table if not exists ` +
+	SCHEMA_TABLE_NAME +
+	`(version int not null);`
+
+// The version, description and type of a row of the first version,
+// parsed from its script name.
+const (
+	SCRIPT_VERSION_EXPRESSION     = `translate(substring(script_name from '^V(\d+(?:[._]\d+)*)__'), '_', '.')`
+	SCRIPT_DESCRIPTION_EXPRESSION = `replace(substring(script_name from '^(?:V\d+(?:[._]\d+)*|R)__(.+)\.sql$'), '_', ' ')`
+	SCRIPT_TYPE_EXPRESSION        = `case when script_name like 'R\_\_%' then 'repeatable' else 'versioned' end`
+)
+
+// SCHEMA_UPGRADES The scripts that upgrade the migration table, the
+// upgrade at index i takes the table from version i+1 to i+2. The first
+// version is the table created by DEFAULT_MIGRATION_SCRIPT, so tables
+// created before the schema version existed are upgraded from it. Every
+// upgrade must be safe to execute on a table that was partially
+// upgraded.
+var SCHEMA_UPGRADES = []string{
+	// Version 2: stores version, description, type, checksum, who
+	// executed the script, how long it took and if it succeeded. Rows
+	// from version 1 have the version, description and type parsed from
+	// the script name.
+	`alter table ` + MIGRATION_TABLE_NAME + `
+add column if not exists version varchar,
+add column if not exists description varchar,
+add column if not exists type varchar not null default 'versioned',
+add column if not exists checksum varchar,
+add column if not exists installed_by varchar not null default current_user,
+add column if not exists execution_time_ms bigint,
+add column if not exists success boolean not null default true;
+update ` + MIGRATION_TABLE_NAME + ` set
+version = ` + SCRIPT_VERSION_EXPRESSION + `,
+description = ` + SCRIPT_DESCRIPTION_EXPRESSION + `,
+type = ` + SCRIPT_TYPE_EXPRESSION + `
+where version is null and description is null;`,
+}
+
+// SCHEMA_VERSION The latest schema version of the migration table.
+var SCHEMA_VERSION = len(SCHEMA_UPGRADES) + 1
+
+// upgradeMigrationTable Executes every upgrade newer than the current
+// schema version of the migration table and stores the new version. A
+// created table is on the first version whatever the stored version,
+// which may be of a migration table that was dropped.
+func (m MigrationRegisterSQL) upgradeMigrationTable(created bool) error {
+	current, err := m.schemaVersion()
+	if err != nil {
+		return err
+	}
+	if created {
+		current = 1
+	}
+	if current >= SCHEMA_VERSION {
+		return nil
+	}
+
+	for version := current + 1; version <= SCHEMA_VERSION; version++ {
+		logrus.WithFields(logrus.Fields{
+			"schema_version": version,
+		}).Info("Upgrading the migration table.")
+		_, err = m.Tx.Exec(SCHEMA_UPGRADES[version-2])
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"schema_version": version,
+			}).Error("Error upgrading the migration table.\n", err)
+			return err
+		}
+	}
+	return m.storeSchemaVersion(SCHEMA_VERSION)
+}
+
+// UpgradeMigrationTable Upgrades the migration table to the latest
+// schema version, nothing is done if it doesn't exist yet.
+func (m MigrationRegisterSQL) UpgradeMigrationTable() error {
+	exists, err := m.MigrationTableExists()
+	if err != nil || !exists {
+		return err
+	}
+	return m.upgradeMigrationTable(false)
+}
+
+// schemaVersion Creates the schema table if needed and returns the
+// current schema version of the migration table. Without any version
+// stored the migration table is on the first version.
+func (m MigrationRegisterSQL) schemaVersion() (int, error) {
+	_, err := m.Tx.Exec(DEFAULT_SCHEMA_SCRIPT)
+	if err != nil {
+		logrus.Error("Error creating the schema table.\n", err)
+		return 0, err
+	}
+	return m.readSchemaVersion()
+}
+
+// storedSchemaVersion Returns the current schema version of the
+// migration table without creating the schema table, so nothing is
+// changed on the database. Without any version stored the migration
+// table is on the first version.
+func (m MigrationRegisterSQL) storedSchemaVersion() (int, error) {
+	query := fmt.Sprintf("SELECT to_regclass('%s') IS NOT NULL", SCHEMA_TABLE_NAME)
+	var exists bool
+	err := m.Tx.QueryRow(query).Scan(&exists)
+	if err != nil {
+		logrus.Error("Error checking if the schema table exists.\n", err)
+		return 0, err
+	}
+	if !exists {
+		return 1, nil
+	}
+	return m.readSchemaVersion()
+}
+
+// readSchemaVersion Reads the schema version from the schema table.
+func (m MigrationRegisterSQL) readSchemaVersion() (int, error) {
+	var version int
+	query := fmt.Sprintf("SELECT coalesce(max(version), 1) FROM %s", SCHEMA_TABLE_NAME)
+	err := m.Tx.QueryRow(query).Scan(&version)
+	if err != nil {
+		logrus.Error("Error reading the schema version.\n", err)
+		return 0, err
+	}
+	return version, nil
+}
+
+// storeSchemaVersion Replaces the schema version of the migration table.
+func (m MigrationRegisterSQL) storeSchemaVersion(version int) error {
+	query := fmt.Sprintf("DELETE FROM %s; INSERT INTO %s (version) VALUES (%d)",
+		SCHEMA_TABLE_NAME, SCHEMA_TABLE_NAME, version)
+	_, err := m.Tx.Exec(query)
+	if err != nil {
+		logrus.Error("Error storing the schema version.\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpgradingMigrationTableFromFirstVersionShouldExecuteEveryUpgrade(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectExec("create table if not exists " + SCHEMA_TABLE_NAME).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	for _, upgrade := range SCHEMA_UPGRADES {
+		mock.ExpectExec(regexp.QuoteMeta(upgrade)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(
+		fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", SCHEMA_TABLE_NAME, SCHEMA_VERSION))).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := registry.upgradeMigrationTable(false)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUpgradingMigrationTableOnLatestVersionShouldDoNothing(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectExec(SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SCHEMA_VERSION))
+
+	err := registry.upgradeMigrationTable(false)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUpgradingCreatedMigrationTableShouldIgnoreTheStoredVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectExec(SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	// The version of a migration table that was dropped.
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(SCHEMA_VERSION))
+	for _, upgrade := range SCHEMA_UPGRADES {
+		mock.ExpectExec(regexp.QuoteMeta(upgrade)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(regexp.QuoteMeta(
+		fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", SCHEMA_TABLE_NAME, SCHEMA_VERSION))).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := registry.upgradeMigrationTable(true)
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUpgradingMigrationTableWithErrorShouldNotStoreTheNewVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	expectedError := errors.New("Error altering table")
+	mock.ExpectExec(SCHEMA_TABLE_NAME).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(SCHEMA_TABLE_NAME).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+	mock.ExpectExec("alter table " + MIGRATION_TABLE_NAME).WillReturnError(expectedError)
+
+	actualError := registry.upgradeMigrationTable(false)
+
+	assert.Equal(t, expectedError, actualError)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestUpgradingMissingMigrationTableShouldDoNothing(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	mock.ExpectBegin()
+	tx, _ := db.Begin()
+
+	registry := MigrationRegisterSQL{tx}
+	mock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + MIGRATION_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	err := registry.UpgradeMigrationTable()
+
+	assert.Nil(t, err)
+	assertDatabaseExpectations(t, mock)
+}
@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// Queryer The statements that can be executed either on a connection or
+// on a transaction, implemented by *sql.Tx and Session.
+type Queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Session A single database connection, every statement is executed on
+// the open transaction or directly on the connection if there's none.
+type Session struct {
+	Conn *sql.Conn
+	tx   *sql.Tx
+	// Cancels every statement of the session, no statement is canceled
+	// if nil.
+	ctx context.Context
+}
+
+// New Reserves a single connection from the database pool, every
+// statement executed on the session is canceled with the context.
+func New(ctx context.Context, db *sql.DB) (*Session, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Conn: conn, ctx: ctx}, nil
+}
+
+// context Returns the context of the statements of the session.
+func (s *Session) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// Begin Opens a transaction, only one transaction can be open at a time.
+func (s *Session) Begin() error {
+	if s.tx != nil {
+		return errors.New("transaction already open")
+	}
+	tx, err := s.Conn.BeginTx(s.context(), nil)
+	if err != nil {
+		return err
+	}
+	s.tx = tx
+	return nil
+}
+
+// Commit Commits the open transaction, does nothing if there's none.
+func (s *Session) Commit() error {
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx = nil
+	return tx.Commit()
+}
+
+// Rollback Rollbacks the open transaction, does nothing if there's none.
+func (s *Session) Rollback() error {
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx = nil
+	return tx.Rollback()
+}
+
+// InTransaction Checks if there's an open transaction.
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// Exec Executes a statement on the open transaction or on the connection.
+func (s *Session) Exec(query string, args ...any) (sql.Result, error) {
+	if s.tx != nil {
+		return s.tx.ExecContext(s.context(), query, args...)
+	}
+	return s.Conn.ExecContext(s.context(), query, args...)
+}
+
+// Query Executes a query on the open transaction or on the connection.
+func (s *Session) Query(query string, args ...any) (*sql.Rows, error) {
+	if s.tx != nil {
+		return s.tx.QueryContext(s.context(), query, args...)
+	}
+	return s.Conn.QueryContext(s.context(), query, args...)
+}
+
+// QueryRow Executes a query that returns a single row on the open
+// transaction or on the connection.
+func (s *Session) QueryRow(query string, args ...any) *sql.Row {
+	if s.tx != nil {
+		return s.tx.QueryRowContext(s.context(), query, args...)
+	}
+	return s.Conn.QueryRowContext(s.context(), query, args...)
+}
+
+// Close Rollbacks any open transaction and returns the connection to
+// the pool.
+func (s *Session) Close() error {
+	err := s.Rollback()
+	closeErr := s.Conn.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWithClosedDatabaseShouldReturnError(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	db.Close()
+
+	session, err := New(context.Background(), db)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, session)
+}
+
+func TestExecWithCanceledContextShouldCancelTheStatement(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectExec("VACUUM").
+		WillDelayFor(time.Minute).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session, _ := New(ctx, db)
+	cancel()
+	_, err := session.Exec("VACUUM")
+
+	assert.Equal(t, sqlmock.ErrCancelled, err)
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestExecWithoutTransactionShouldExecuteOnTheConnection(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectExec("VACUUM").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	session, _ := New(context.Background(), db)
+	_, err := session.Exec("VACUUM")
+
+	assert.Nil(t, err)
+	assert.False(t, session.InTransaction())
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestExecInTransactionShouldExecuteOnTheTransactionUntilCommit(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	session, _ := New(context.Background(), db)
+	assert.Nil(t, session.Begin())
+	assert.True(t, session.InTransaction())
+	_, err := session.Exec("INSERT INTO users VALUES (1)")
+	assert.Nil(t, err)
+	assert.Nil(t, session.Commit())
+
+	assert.False(t, session.InTransaction())
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestBeginWithOpenTransactionShouldReturnError(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+
+	session, _ := New(context.Background(), db)
+	session.Begin()
+
+	assert.NotNil(t, session.Begin())
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestRollbackWithErrorShouldCloseTheTransaction(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	expectedError := errors.New("Error rollbacking")
+	mock.ExpectBegin()
+	mock.ExpectRollback().WillReturnError(expectedError)
+
+	session, _ := New(context.Background(), db)
+	session.Begin()
+
+	assert.Equal(t, expectedError, session.Rollback())
+	assert.False(t, session.InTransaction())
+	assert.Nil(t, session.Rollback())
+	assertDatabaseExpectations(t, mock)
+}
+
+func TestCloseShouldRollbackOpenTransaction(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	session, _ := New(context.Background(), db)
+	session.Begin()
+
+	assert.Nil(t, session.Close())
+	assertDatabaseExpectations(t, mock)
+}
+
+func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Not all expectation were met: %s", err)
+	}
+}
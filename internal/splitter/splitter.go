@@ -0,0 +1,186 @@
+// Package splitter splits PostgreSQL scripts into statements, following
+// the lexical rules of PostgreSQL so that semicolons inside string
+// literals, quoted identifiers, comments and dollar-quoted bodies don't
+// end a statement.
+package splitter
+
+import "strings"
+
+// WHITESPACE The characters PostgreSQL considers whitespace between tokens.
+const WHITESPACE = " \t\n\r\f\v"
+
+// Statement A single statement of a script.
+type Statement struct {
+	// The statement without the terminating semicolon, leading comments
+	// and surrounding whitespace.
+	Content string
+	// The line of the script where the statement starts, counting from 1.
+	Line int
+}
+
+// Split Splits the script into statements. Statements with only comments
+// or whitespace are ignored. Unterminated literals and comments extend
+// to the end of the script, leaving the error to the database.
+func Split(script string) []Statement {
+	statements := []Statement{}
+	start, startLine := -1, 0
+	line := 1
+
+	for position := 0; position < len(script); {
+		end, isCode := nextToken(script, position)
+		if script[position] == ';' {
+			if start >= 0 {
+				statements = append(statements, newStatement(script[start:position], startLine))
+				start = -1
+			}
+		} else if isCode && start < 0 {
+			start, startLine = position, line
+		}
+		line += strings.Count(script[position:end], "\n")
+		position = end
+	}
+
+	if start >= 0 {
+		statements = append(statements, newStatement(script[start:], startLine))
+	}
+	return statements
+}
+
+func newStatement(content string, line int) Statement {
+	return Statement{
+		Content: strings.TrimRight(content, WHITESPACE),
+		Line:    line,
+	}
+}
+
+// nextToken Returns the end of the token starting at the position and if
+// it's part of a statement, comments and whitespace are not.
+func nextToken(script string, position int) (int, bool) {
+	switch current := script[position]; {
+	case strings.IndexByte(WHITESPACE, current) >= 0:
+		return position + 1, false
+	case strings.HasPrefix(script[position:], "--"):
+		return lineCommentEnd(script, position), false
+	case strings.HasPrefix(script[position:], "/*"):
+		return blockCommentEnd(script, position), false
+	case current == '\'':
+		return quotedEnd(script, position, '\'', isEscapeString(script, position)), true
+	case current == '"':
+		return quotedEnd(script, position, '"', false), true
+	case current == '$':
+		if tag, ok := dollarTag(script, position); ok {
+			return dollarQuotedEnd(script, position, tag), true
+		}
+		return position + 1, true
+	default:
+		return position + 1, true
+	}
+}
+
+// lineCommentEnd Returns the end of the comment started by "--", the
+// line break is not part of the comment.
+func lineCommentEnd(script string, position int) int {
+	end := strings.IndexByte(script[position:], '\n')
+	if end < 0 {
+		return len(script)
+	}
+	return position + end
+}
+
+// blockCommentEnd Returns the end of the comment started by "/*", block
+// comments nest in PostgreSQL.
+func blockCommentEnd(script string, position int) int {
+	depth := 0
+	for position < len(script) {
+		switch {
+		case strings.HasPrefix(script[position:], "/*"):
+			depth++
+			position += 2
+		case strings.HasPrefix(script[position:], "*/"):
+			depth--
+			position += 2
+			if depth == 0 {
+				return position
+			}
+		default:
+			position++
+		}
+	}
+	return len(script)
+}
+
+// quotedEnd Returns the end of the literal or identifier started by the
+// quote, a doubled quote is part of the content and, on escape strings,
+// so is any character after a backslash.
+func quotedEnd(script string, position int, quote byte, backslashEscapes bool) int {
+	position++
+	for position < len(script) {
+		switch script[position] {
+		case '\\':
+			if backslashEscapes {
+				position++
+			}
+		case quote:
+			if position+1 < len(script) && script[position+1] == quote {
+				position++
+			} else {
+				return position + 1
+			}
+		}
+		position++
+	}
+	return len(script)
+}
+
+// isEscapeString Checks if the literal starting at the position is an
+// escape string, like E'\n'.
+func isEscapeString(script string, position int) bool {
+	if position == 0 || (script[position-1] != 'E' && script[position-1] != 'e') {
+		return false
+	}
+	return position == 1 || !isIdentifierCharacter(script[position-2])
+}
+
+// dollarTag Returns the tag, delimiters included, of the dollar quote
+// starting at the position, like $$ or $body$. A dollar sign after an
+// identifier character is part of the identifier and a dollar sign
+// followed by digits is a positional parameter.
+func dollarTag(script string, position int) (string, bool) {
+	if position > 0 && isIdentifierCharacter(script[position-1]) {
+		return "", false
+	}
+	for end := position + 1; end < len(script); end++ {
+		current := script[end]
+		switch {
+		case current == '$':
+			return script[position : end+1], true
+		case end == position+1 && isDigit(current):
+			return "", false
+		case !isIdentifierCharacter(current):
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// dollarQuotedEnd Returns the end of the body quoted by the tag.
+func dollarQuotedEnd(script string, position int, tag string) int {
+	end := strings.Index(script[position+len(tag):], tag)
+	if end < 0 {
+		return len(script)
+	}
+	return position + len(tag) + end + len(tag)
+}
+
+// isIdentifierCharacter Checks if the byte can be part of an unquoted
+// identifier, bytes of multibyte characters are letters for PostgreSQL.
+func isIdentifierCharacter(character byte) bool {
+	return character == '_' || character == '$' || isDigit(character) ||
+		(character >= 'a' && character <= 'z') ||
+		(character >= 'A' && character <= 'Z') ||
+		character >= 0x80
+}
+
+func isDigit(character byte) bool {
+	return character >= '0' && character <= '9'
+}
@@ -0,0 +1,157 @@
+package splitter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatementsShouldReturnEveryStatementWithItsLine(t *testing.T) {
+	script := "CREATE TABLE users (id int);\n\nINSERT INTO users VALUES (1);\nINSERT INTO users VALUES (2)"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "CREATE TABLE users (id int)", Line: 1},
+		{Content: "INSERT INTO users VALUES (1)", Line: 3},
+		{Content: "INSERT INTO users VALUES (2)", Line: 4},
+	}, statements)
+}
+
+func TestSplitEmptyScriptShouldReturnNoStatements(t *testing.T) {
+	statements := Split("  \n;;\n -- only a comment;\n/* another; */")
+
+	assert.Empty(t, statements)
+}
+
+func TestSplitStatementWithLeadingCommentShouldStartOnTheStatementLine(t *testing.T) {
+	script := "-- Creates the users; table\n/* multi\nline; */\nCREATE TABLE users (id int); -- trailing;\n"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "CREATE TABLE users (id int)", Line: 4},
+	}, statements)
+}
+
+func TestSplitStatementWithSemicolonInsideStringShouldNotSplitIt(t *testing.T) {
+	script := "INSERT INTO users VALUES ('a;b', 'it''s;');\nSELECT E'\\';', \"odd;name\" FROM \"t\"\"x;\";"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "INSERT INTO users VALUES ('a;b', 'it''s;')", Line: 1},
+		{Content: "SELECT E'\\';', \"odd;name\" FROM \"t\"\"x;\"", Line: 2},
+	}, statements)
+}
+
+func TestSplitStatementWithBackslashInStandardStringShouldEndTheString(t *testing.T) {
+	script := "SELECT 'C:\\';SELECT 2"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "SELECT 'C:\\'", Line: 1},
+		{Content: "SELECT 2", Line: 1},
+	}, statements)
+}
+
+func TestSplitStatementWithSemicolonInsideNestedCommentShouldNotSplitIt(t *testing.T) {
+	script := "SELECT 1 /* outer /* inner; */ still comment; */ + 1;\nSELECT 2;"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "SELECT 1 /* outer /* inner; */ still comment; */ + 1", Line: 1},
+		{Content: "SELECT 2", Line: 2},
+	}, statements)
+}
+
+func TestSplitFunctionWithDollarQuotedBodyShouldNotSplitIt(t *testing.T) {
+	function := `CREATE FUNCTION increment(i integer) RETURNS integer AS $$
+BEGIN
+    RETURN i + 1;
+END;
+$$ LANGUAGE plpgsql`
+	tagged := `DO $body$
+BEGIN
+    PERFORM 'not the end $$;';
+END
+$body$`
+	script := function + ";\n" + tagged + ";\n"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: function, Line: 1},
+		{Content: tagged, Line: 6},
+	}, statements)
+}
+
+func TestSplitDollarSignsThatAreNotQuotesShouldSplitOnSemicolons(t *testing.T) {
+	script := "PREPARE find AS SELECT * FROM users WHERE id = $1;SELECT a$b$ FROM t;SELECT 2"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "PREPARE find AS SELECT * FROM users WHERE id = $1", Line: 1},
+		{Content: "SELECT a$b$ FROM t", Line: 1},
+		{Content: "SELECT 2", Line: 1},
+	}, statements)
+}
+
+func TestSplitUnterminatedStringShouldExtendToTheEndOfTheScript(t *testing.T) {
+	script := "SELECT 1;\nSELECT 'unterminated; string;\n"
+
+	statements := Split(script)
+
+	assert.Equal(t, []Statement{
+		{Content: "SELECT 1", Line: 1},
+		{Content: "SELECT 'unterminated; string;", Line: 2},
+	}, statements)
+}
+
+func FuzzSplit(f *testing.F) {
+	f.Add("CREATE TABLE users (id int);\nINSERT INTO users VALUES (1);")
+	f.Add("SELECT 'a;b', E'\\';', \"c;d\"; -- comment;\n/* a /* b; */ c; */ SELECT 2")
+	f.Add("CREATE FUNCTION f() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;\nDO $x$ BEGIN END; $x$;")
+	f.Add("SELECT $1; SELECT a$b$; SELECT 'unterminated")
+
+	f.Fuzz(func(t *testing.T, script string) {
+		statements := Split(script)
+
+		lines := strings.Count(script, "\n") + 1
+		previousLine := 1
+		for _, statement := range statements {
+			if statement.Content == "" || strings.TrimRight(statement.Content, WHITESPACE) != statement.Content {
+				t.Fatalf("statement %q is empty or has trailing whitespace", statement.Content)
+			}
+			if !strings.Contains(script, statement.Content) {
+				t.Fatalf("statement %q is not part of the script", statement.Content)
+			}
+			if statement.Line < previousLine || statement.Line > lines {
+				t.Fatalf("statement %q starts on line %d, after line %d and before line %d",
+					statement.Content, statement.Line, previousLine, lines)
+			}
+			previousLine = statement.Line
+		}
+
+		// Splitting the statements joined again must return the same
+		// statements, semicolons inside them can't end a statement.
+		contents := make([]string, len(statements))
+		for i, statement := range statements {
+			contents[i] = statement.Content
+		}
+		resplit := Split(strings.Join(contents, "\n;\n"))
+		if len(resplit) != len(statements) {
+			t.Fatalf("splitting %q again returned %d statements instead of %d",
+				contents, len(resplit), len(statements))
+		}
+		for i := range resplit {
+			if resplit[i].Content != statements[i].Content {
+				t.Fatalf("splitting again returned %q instead of %q", resplit[i].Content, statements[i].Content)
+			}
+		}
+	})
+}
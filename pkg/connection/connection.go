@@ -1,5 +1,22 @@
 package connection
 
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// DEFAULT_ADDRESS The server address when neither the address, PGHOST
+// nor PGSERVICE are given.
+const DEFAULT_ADDRESS = "localhost"
+
+// SSL_MODES The sslmode values, from the least to the most secure.
+var SSL_MODES = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
 // DatabaseInformation Basic information needed to stablish a database connection.
 type DatabaseInformation struct {
 	User     string
@@ -7,4 +24,134 @@ type DatabaseInformation struct {
 	Address  string
 	Port     string
 	Database string
+	// The file with the password, or the command that prints it, used
+	// instead of the Password by ResolvePassword.
+	PasswordFile    string
+	PasswordCommand string
+	// The TLS settings, like on libpq. SSLMode is one of SSL_MODES, the
+	// other fields are the paths of the PEM files of the root
+	// certificate, the client certificate and its key.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+}
+
+// TLSError A TLS setting is invalid or its file can't be read.
+type TLSError struct {
+	Setting string
+	Path    string
+	Err     error
+}
+
+func (e TLSError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("invalid %s: %s", e.Setting, e.Err)
+	}
+	return fmt.Sprintf("invalid %s %s: %s", e.Setting, e.Path, e.Err)
+}
+
+func (e TLSError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNoPEMData The file of a certificate or key has no PEM block.
+var ErrNoPEMData = errors.New("no PEM data found")
+
+// URL Builds the postgres connection URL, every field is escaped so
+// passwords and names can have characters like @, / or :. Empty fields
+// are left out of the URL, so they're read like libpq does, from the
+// PGHOST, PGPORT, PGUSER, PGPASSWORD, PGDATABASE and PGSSLMODE
+// environment variables, from the service of PGSERVICE on
+// ~/.pg_service.conf and, for the password, from ~/.pgpass. Without an
+// address, PGHOST or PGSERVICE the address is DEFAULT_ADDRESS. The TLS
+// settings are added as query parameters.
+func (d DatabaseInformation) URL() string {
+	databaseURL := url.URL{
+		Scheme: "postgres",
+		Path:   "/" + d.Database,
+	}
+	address := d.Address
+	if address == "" && os.Getenv("PGHOST") == "" && os.Getenv("PGSERVICE") == "" {
+		// pgx would default to the first socket directory that exists,
+		// like /tmp, even without a server listening on it.
+		address = DEFAULT_ADDRESS
+	}
+	if d.Port != "" {
+		databaseURL.Host = net.JoinHostPort(address, d.Port)
+	} else if strings.Contains(address, ":") {
+		databaseURL.Host = "[" + address + "]"
+	} else {
+		databaseURL.Host = address
+	}
+	switch {
+	case d.User != "" && d.Password != "":
+		databaseURL.User = url.UserPassword(d.User, d.Password)
+	case d.User != "":
+		databaseURL.User = url.User(d.User)
+	}
+	query := url.Values{}
+	if d.User == "" && d.Password != "" {
+		// An empty user on the URL would replace PGUSER.
+		query.Set("password", d.Password)
+	}
+	for _, setting := range d.tlsSettings() {
+		if setting.value != "" {
+			query.Set(setting.name, setting.value)
+		}
+	}
+	databaseURL.RawQuery = query.Encode()
+	return databaseURL.String()
+}
+
+// tlsSetting A TLS setting with its name on the connection URL.
+type tlsSetting struct {
+	name  string
+	value string
+}
+
+// tlsSettings Returns the TLS settings, the sslmode first and then the
+// files, in the order they're validated.
+func (d DatabaseInformation) tlsSettings() []tlsSetting {
+	return []tlsSetting{
+		{name: "sslmode", value: d.SSLMode},
+		{name: "sslrootcert", value: d.SSLRootCert},
+		{name: "sslcert", value: d.SSLCert},
+		{name: "sslkey", value: d.SSLKey},
+	}
+}
+
+// ValidateTLS Returns a TLSError if the sslmode is unknown, if only one
+// of the client certificate and its key is given, or if any certificate
+// or key file can't be read or has no PEM data. It's meant to be called
+// before connecting, the connection would fail with a less clear error.
+func (d DatabaseInformation) ValidateTLS() error {
+	if d.SSLMode != "" {
+		known := false
+		for _, mode := range SSL_MODES {
+			known = known || d.SSLMode == mode
+		}
+		if !known {
+			return TLSError{Setting: "sslmode", Err: fmt.Errorf("%q, expected one of %s",
+				d.SSLMode, strings.Join(SSL_MODES, ", "))}
+		}
+	}
+	if (d.SSLCert == "") != (d.SSLKey == "") {
+		return TLSError{Setting: "sslcert and sslkey", Err: errors.New("the client certificate and its key must be given together")}
+	}
+
+	// The settings after the sslmode are files.
+	for _, setting := range d.tlsSettings()[1:] {
+		if setting.value == "" {
+			continue
+		}
+		content, err := os.ReadFile(setting.value)
+		if err != nil {
+			return TLSError{Setting: setting.name, Path: setting.value, Err: err}
+		}
+		if block, _ := pem.Decode(content); block == nil {
+			return TLSError{Setting: setting.name, Path: setting.value, Err: ErrNoPEMData}
+		}
+	}
+	return nil
 }
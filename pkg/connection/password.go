@@ -0,0 +1,115 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// PasswordError The password couldn't be read from its file or command.
+type PasswordError struct {
+	// The setting with the password, password-file or password-command.
+	Setting string
+	Err     error
+}
+
+func (e PasswordError) Error() string {
+	return fmt.Sprintf("error reading the password from %s: %s", e.Setting, e.Err)
+}
+
+func (e PasswordError) Unwrap() error {
+	return e.Err
+}
+
+// ErrEmptyPassword The password file or command has no password.
+var ErrEmptyPassword = errors.New("the password is empty")
+
+// ResolvePassword Returns the database information with the password
+// read from the PasswordFile or from the standard output of the
+// PasswordCommand, without the trailing new line. Returns a
+// PasswordError if more than one of the Password, the PasswordFile and
+// the PasswordCommand are given, or if the password can't be read or is
+// empty. The command is executed by the shell and canceled with the
+// context.
+func (d DatabaseInformation) ResolvePassword(ctx context.Context) (DatabaseInformation, error) {
+	given := []string{}
+	if d.Password != "" {
+		given = append(given, "password")
+	}
+	if d.PasswordFile != "" {
+		given = append(given, "password-file")
+	}
+	if d.PasswordCommand != "" {
+		given = append(given, "password-command")
+	}
+	if len(given) > 1 {
+		return d, PasswordError{Setting: strings.Join(given, " and "), Err: errors.New("only one of them can be given")}
+	}
+
+	var password string
+	var err error
+	switch {
+	case d.PasswordFile != "":
+		password, err = readPasswordFile(d.PasswordFile)
+		if err != nil {
+			return d, PasswordError{Setting: "password-file", Err: err}
+		}
+	case d.PasswordCommand != "":
+		password, err = runPasswordCommand(ctx, d.PasswordCommand)
+		if err != nil {
+			return d, PasswordError{Setting: "password-command", Err: err}
+		}
+	default:
+		return d, nil
+	}
+
+	d.Password = password
+	d.PasswordFile = ""
+	d.PasswordCommand = ""
+	return d, nil
+}
+
+// readPasswordFile Returns the content of the file without the trailing
+// new line, ErrEmptyPassword if there's nothing else.
+func readPasswordFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(string(content), "\r\n")
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	return password, nil
+}
+
+// runPasswordCommand Executes the command on the shell and returns its
+// standard output, the standard error is on the error if it fails.
+func runPasswordCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%w: %s", err, message)
+		}
+		return "", err
+	}
+
+	password := strings.TrimRight(stdout.String(), "\r\n")
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+	return password, nil
+}
@@ -0,0 +1,71 @@
+package connection
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolvePasswordWithPasswordFileShouldReadItWithoutTheNewLine(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passwordFile, []byte("s3cret\n"), 0600)
+
+	information, err := DatabaseInformation{User: "user", PasswordFile: passwordFile}.ResolvePassword(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, DatabaseInformation{User: "user", Password: "s3cret"}, information)
+}
+
+func TestResolvePasswordWithMissingPasswordFileShouldReturnPasswordError(t *testing.T) {
+	_, err := DatabaseInformation{PasswordFile: "non_existent_password"}.ResolvePassword(context.Background())
+
+	var passwordError PasswordError
+	assert.ErrorAs(t, err, &passwordError)
+	assert.Equal(t, "password-file", passwordError.Setting)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestResolvePasswordWithEmptyPasswordFileShouldReturnErrEmptyPassword(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	os.WriteFile(passwordFile, []byte("\n"), 0600)
+
+	_, err := DatabaseInformation{PasswordFile: passwordFile}.ResolvePassword(context.Background())
+
+	assert.ErrorIs(t, err, ErrEmptyPassword)
+}
+
+func TestResolvePasswordWithPasswordCommandShouldUseItsOutput(t *testing.T) {
+	information, err := DatabaseInformation{PasswordCommand: "echo token-$((40 + 2))"}.ResolvePassword(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, "token-42", information.Password)
+	assert.Empty(t, information.PasswordCommand)
+}
+
+func TestResolvePasswordWithFailedPasswordCommandShouldReturnItsStandardError(t *testing.T) {
+	_, err := DatabaseInformation{PasswordCommand: "echo token expired >&2; exit 3"}.ResolvePassword(context.Background())
+
+	var passwordError PasswordError
+	assert.ErrorAs(t, err, &passwordError)
+	assert.Equal(t, "password-command", passwordError.Setting)
+	assert.ErrorContains(t, err, "token expired")
+}
+
+func TestResolvePasswordWithPasswordAndPasswordFileShouldReturnPasswordError(t *testing.T) {
+	_, err := DatabaseInformation{Password: "123", PasswordFile: "password"}.ResolvePassword(context.Background())
+
+	var passwordError PasswordError
+	assert.ErrorAs(t, err, &passwordError)
+	assert.Equal(t, "password and password-file", passwordError.Setting)
+}
+
+func TestResolvePasswordWithoutPasswordSourcesShouldKeepTheInformation(t *testing.T) {
+	information, err := DatabaseInformation{User: "user", Password: "123"}.ResolvePassword(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, DatabaseInformation{User: "user", Password: "123"}, information)
+}
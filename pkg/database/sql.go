@@ -1,9 +1,82 @@
 package database
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ScriptType The kind of a script, defined by the filename prefix.
+type ScriptType string
+
+const (
+	// SCRIPT_VERSIONED Scripts with the V prefix, executed only once
+	// ordered by version.
+	SCRIPT_VERSIONED ScriptType = "versioned"
+	// SCRIPT_REPEATABLE Scripts with the R prefix, executed after all
+	// versioned scripts every time their checksum changes.
+	SCRIPT_REPEATABLE ScriptType = "repeatable"
+	// SCRIPT_UNDO Scripts with the U prefix, they revert the versioned
+	// script with the same version.
+	SCRIPT_UNDO ScriptType = "undo"
+	// SCRIPT_BASELINE The baseline marker on the migration table, every
+	// versioned script up to its version is considered executed.
+	SCRIPT_BASELINE ScriptType = "baseline"
+	// SCRIPT_DELETED A script on the migration table deleted from the
+	// migration directory, marked by the repair.
+	SCRIPT_DELETED ScriptType = "deleted"
+)
+
 // SQLScript Represents a SQL script with the filename and content.
 type SQLScript struct {
 	// The actual SQL script content.
 	Content string
 	// The script filename with the .sql extension.
 	Name string
+	// The kind of the script, versioned, repeatable or undo.
+	Type ScriptType
+	// The version parsed from the filename, V1_2__desc.sql is 1.2.
+	// Repeatable scripts don't have a version.
+	Version Version
+	// The description parsed from the filename with the underscores
+	// replaced by spaces.
+	Description string
+	// If the script must be executed outside a transaction, like
+	// CREATE INDEX CONCURRENTLY, set by the -- grotto:no-transaction
+	// header.
+	NoTransaction bool
+	// The undo script that reverts a versioned script, nil if there is
+	// none.
+	Undo *SQLScript
+}
+
+// Checksum The SHA-256 of the script content in hexadecimal, used to
+// know if the script changed after it was executed.
+func (s SQLScript) Checksum() string {
+	sum := sha256.Sum256([]byte(s.Content))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationRecord Represents a row of the migration table, a script
+// that was already executed.
+type MigrationRecord struct {
+	// The script filename with the .sql extension.
+	ScriptName string
+	// The version of the script, nil for repeatable scripts.
+	Version Version
+	// The description parsed from the filename.
+	Description string
+	// The kind of the script when it was executed.
+	Type ScriptType
+	// The checksum of the script when it was executed, empty for
+	// scripts executed before checksums were stored.
+	Checksum string
+	// The database user that executed the script.
+	InstalledBy string
+	// The date the script was executed.
+	CreatedAt time.Time
+	// How long the script took to execute.
+	ExecutionTime time.Duration
+	// If the script was executed successfully.
+	Success bool
 }
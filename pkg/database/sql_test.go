@@ -0,0 +1,16 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumShouldChangeWithTheContent(t *testing.T) {
+	script := SQLScript{Name: "R__views.sql", Content: "create view v as select 1"}
+	changed := SQLScript{Name: "R__views.sql", Content: "create view v as select 2"}
+
+	assert.Len(t, script.Checksum(), 64)
+	assert.Equal(t, script.Checksum(), SQLScript{Content: script.Content}.Checksum())
+	assert.NotEqual(t, script.Checksum(), changed.Checksum())
+}
@@ -0,0 +1,50 @@
+package database
+
+const (
+	// TARGET_LATEST Targets the latest version on the migration
+	// directory, every pending script is executed.
+	TARGET_LATEST = "latest"
+	// TARGET_CURRENT Targets the latest executed version, no new
+	// versioned script is executed.
+	TARGET_CURRENT = "current"
+)
+
+// Target The version a migration goes up to, versioned scripts newer
+// than it are not executed. The zero value targets the latest version.
+type Target struct {
+	// The target version, the latest version if nil.
+	Version Version
+	// Targets the latest executed version instead of a fixed version.
+	Current bool
+}
+
+// ParseTarget Parses a target, either a version, latest or current.
+func ParseTarget(target string) (Target, error) {
+	switch target {
+	case TARGET_LATEST:
+		return Target{}, nil
+	case TARGET_CURRENT:
+		return Target{Current: true}, nil
+	}
+	version, err := ParseVersion(target)
+	if err != nil {
+		return Target{}, err
+	}
+	return Target{Version: version}, nil
+}
+
+// IsLatest Checks if the target is the latest version.
+func (t Target) IsLatest() bool {
+	return t.Version == nil && !t.Current
+}
+
+// String Returns the target as it's parsed.
+func (t Target) String() string {
+	if t.Current {
+		return TARGET_CURRENT
+	}
+	if t.Version == nil {
+		return TARGET_LATEST
+	}
+	return t.Version.String()
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTargetShouldAcceptVersionsLatestAndCurrent(t *testing.T) {
+	for target, expected := range map[string]Target{
+		"latest":  {},
+		"current": {Current: true},
+		"1.2":     {Version: Version{1, 2}},
+		"3_1":     {Version: Version{3, 1}},
+	} {
+		parsed, err := ParseTarget(target)
+
+		assert.Nil(t, err)
+		assert.Equal(t, expected, parsed)
+	}
+}
+
+func TestParseInvalidTargetShouldReturnError(t *testing.T) {
+	_, err := ParseTarget("newest")
+
+	assert.NotNil(t, err)
+}
+
+func TestTargetStringShouldReturnTheParsedTarget(t *testing.T) {
+	for _, target := range []string{"latest", "current", "1.2"} {
+		parsed, _ := ParseTarget(target)
+
+		assert.Equal(t, target, parsed.String())
+	}
+}
+
+func TestOnlyTheZeroTargetShouldBeTheLatest(t *testing.T) {
+	assert.True(t, Target{}.IsLatest())
+	assert.False(t, Target{Current: true}.IsLatest())
+	assert.False(t, Target{Version: Version{1}}.IsLatest())
+}
@@ -0,0 +1,29 @@
+package database
+
+import "fmt"
+
+// TransactionMode Defines how the scripts are grouped in transactions.
+type TransactionMode string
+
+const (
+	// TRANSACTION_PER_SCRIPT Each script is executed and registered in
+	// its own transaction, the migration stops at the first failure
+	// keeping the scripts already executed.
+	TRANSACTION_PER_SCRIPT TransactionMode = "per-script"
+	// TRANSACTION_ALL Every script is executed in a single transaction,
+	// nothing is kept if any script fails.
+	TRANSACTION_ALL TransactionMode = "all"
+	// TRANSACTION_NONE No transaction is opened, every statement is
+	// committed as soon as it's executed.
+	TRANSACTION_NONE TransactionMode = "none"
+)
+
+// ParseTransactionMode Parses one of the transaction modes.
+func ParseTransactionMode(mode string) (TransactionMode, error) {
+	switch TransactionMode(mode) {
+	case TRANSACTION_PER_SCRIPT, TRANSACTION_ALL, TRANSACTION_NONE:
+		return TransactionMode(mode), nil
+	}
+	return "", fmt.Errorf("invalid transaction mode %q, expected %s, %s or %s",
+		mode, TRANSACTION_PER_SCRIPT, TRANSACTION_ALL, TRANSACTION_NONE)
+}
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTransactionModeShouldAcceptEveryMode(t *testing.T) {
+	for _, mode := range []TransactionMode{TRANSACTION_PER_SCRIPT, TRANSACTION_ALL, TRANSACTION_NONE} {
+		parsed, err := ParseTransactionMode(string(mode))
+
+		assert.Nil(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+}
+
+func TestParseInvalidTransactionModeShouldReturnError(t *testing.T) {
+	_, err := ParseTransactionMode("per-file")
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version A script version, like 1.2.3, each part is compared
+// numerically so 10 comes after 2.
+type Version []uint64
+
+// ParseVersion Parses a version with its parts separated by dots or
+// underscores, like 1.2.3 or 1_2_3. Every part must be a number, so
+// versions like 1..2 or 1. are invalid.
+func ParseVersion(version string) (Version, error) {
+	fields := strings.Split(strings.ReplaceAll(version, "_", "."), ".")
+	parsed := make(Version, len(fields))
+	for index, field := range fields {
+		part, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version: %q", version)
+		}
+		parsed[index] = part
+	}
+	return parsed, nil
+}
+
+// Compare Compares two versions part by part, missing parts are
+// considered zero, so 1 and 1.0 are the same version. Returns -1 if v
+// is lower than other, 1 if it's greater and 0 if they are equal.
+func (v Version) Compare(other Version) int {
+	length := len(v)
+	if len(other) > length {
+		length = len(other)
+	}
+	for index := 0; index < length; index++ {
+		var left, right uint64
+		if index < len(v) {
+			left = v[index]
+		}
+		if index < len(other) {
+			right = other[index]
+		}
+		if left < right {
+			return -1
+		}
+		if left > right {
+			return 1
+		}
+	}
+	return 0
+}
+
+// String Formats the version with its parts separated by dots.
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for index, part := range v {
+		parts[index] = strconv.FormatUint(part, 10)
+	}
+	return strings.Join(parts, ".")
+}
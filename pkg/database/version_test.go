@@ -0,0 +1,30 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionWithDotsAndUnderscoresShouldReturnAllParts(t *testing.T) {
+	version, err := ParseVersion("1.2_3")
+
+	assert.Nil(t, err)
+	assert.Equal(t, Version{1, 2, 3}, version)
+	assert.Equal(t, "1.2.3", version.String())
+}
+
+func TestParseInvalidVersionShouldReturnError(t *testing.T) {
+	for _, invalid := range []string{"", "a", "1.a", "99999999999999999999", "1..2", ".5", "_1", "1.", "1_.2"} {
+		_, err := ParseVersion(invalid)
+
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestCompareVersionsShouldCompareNumerically(t *testing.T) {
+	assert.Equal(t, -1, Version{2}.Compare(Version{10}))
+	assert.Equal(t, 1, Version{1, 10}.Compare(Version{1, 2}))
+	assert.Equal(t, 0, Version{1}.Compare(Version{1, 0}))
+	assert.Equal(t, -1, Version{1}.Compare(Version{1, 0, 1}))
+}
@@ -0,0 +1,205 @@
+// Package grotto Executes the grotto commands from Go code, like
+// migrating the database on the startup of a service. Every failure is
+// returned as one of the error types below, nothing exits the process.
+package grotto
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+
+	"github.com/eaneto/grotto/internal/executor"
+	"github.com/eaneto/grotto/internal/lock"
+	"github.com/eaneto/grotto/internal/reader"
+	"github.com/eaneto/grotto/pkg/connection"
+	"github.com/eaneto/grotto/pkg/database"
+	"github.com/eaneto/grotto/pkg/processor"
+	"github.com/jackc/pgx/v4"
+)
+
+// Options The database, the migration directories and the options of the
+// commands. The database is the first set of DB, ConnConfig, DatabaseURL
+// and Database.
+type Options struct {
+	// An existing pool, it's not closed by the commands.
+	DB *sql.DB
+	// A pgx connection config.
+	ConnConfig *pgx.ConnConfig
+	// A postgres URL or DSN.
+	DatabaseURL string
+	// The connection fields, escaped into a postgres URL. The empty
+	// fields are read from the PG* environment variables, the service
+	// file and the password file, like libpq. The password can also be
+	// read from the PasswordFile or the PasswordCommand.
+	Database connection.DatabaseInformation
+	// The migration directories containing the scripts, merged by
+	// version, a directory can be a glob pattern like modules/*/migrations.
+	Directories []string
+	// The file system of the migration directories, like the directories
+	// embedded with go:embed, the operating system's if nil.
+	FS fs.FS
+	processor.Options
+}
+
+// Result The scripts applied and skipped by a migration.
+type Result = processor.MigrationResult
+
+// ScriptInfo The state of a script listed by Info.
+type ScriptInfo = processor.ScriptInfo
+
+// RepairChange A change made on the migration table by Repair.
+type RepairChange = processor.RepairChange
+
+// The errors returned by the commands, use errors.As to inspect them.
+type (
+	// ConnectionError The database couldn't be reached.
+	ConnectionError = processor.ConnectionError
+	// ReadError The migration directory or a script couldn't be read.
+	ReadError = reader.ReadError
+	// ScriptNameError A script doesn't follow the naming convention.
+	ScriptNameError = reader.ScriptNameError
+	// DuplicateVersionError Two scripts have the same version.
+	DuplicateVersionError = reader.DuplicateVersionError
+	// DuplicateScriptError Two migration directories have a repeatable
+	// script with the same name.
+	DuplicateScriptError = reader.DuplicateScriptError
+	// UndoWithoutScriptError An undo script has no versioned script.
+	UndoWithoutScriptError = reader.UndoWithoutScriptError
+	// ValidationError The executed scripts don't match the migration
+	// directory.
+	ValidationError = processor.ValidationError
+	// ScriptError A statement of a script failed.
+	ScriptError = executor.ScriptError
+	// UndoError Some executed scripts have no undo script.
+	UndoError = processor.UndoError
+)
+
+var (
+	// ErrLockTimeout Another migration held the migration lock longer
+	// than the lock timeout.
+	ErrLockTimeout = lock.ErrLockTimeout
+	// ErrCleanDisabled Clean was called without enabling it.
+	ErrCleanDisabled = processor.ErrCleanDisabled
+)
+
+// Migrate Executes all pending scripts. The result has the scripts
+// executed before any failure, it's nil only if the database can't be
+// reached.
+func Migrate(ctx context.Context, options Options) (*Result, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	result, err := migrationProcessor.ProcessMigration()
+	return &result, err
+}
+
+// Info Lists the state of every script, nothing is changed.
+func Info(ctx context.Context, options Options) ([]ScriptInfo, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Info()
+}
+
+// Validate Returns a ValidationError if the executed scripts were
+// modified, are missing or unknown.
+func Validate(ctx context.Context, options Options) error {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Validate()
+}
+
+// Plan Lists the scripts a migration would execute, nothing is changed.
+func Plan(ctx context.Context, options Options) ([]database.SQLScript, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Plan()
+}
+
+// Undo Executes the undo scripts of the latest executed version, or of
+// every version newer than the target, and returns their names.
+func Undo(ctx context.Context, options Options) ([]string, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Undo()
+}
+
+// Baseline Marks the scripts up to the baseline version as executed.
+func Baseline(ctx context.Context, options Options) error {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Baseline()
+}
+
+// Repair Fixes failed, edited and deleted scripts on the migration table
+// and returns every change made.
+func Repair(ctx context.Context, options Options) ([]RepairChange, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Repair()
+}
+
+// Clean Drops every object in the clean schemas and returns them,
+// returns ErrCleanDisabled unless the clean is enabled.
+func Clean(ctx context.Context, options Options) ([]string, error) {
+	migrationProcessor, err := open(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	defer migrationProcessor.Close()
+
+	return migrationProcessor.Clean()
+}
+
+// open Connects to the database of the options.
+func open(ctx context.Context, options Options) (processor.MigrationProcessorSQL, error) {
+	var migrationProcessor processor.MigrationProcessorSQL
+	var err error
+	switch {
+	case options.DB != nil:
+		migrationProcessor, err = processor.NewFromDB(ctx, options.DB, options.Directories, options.Options)
+	case options.ConnConfig != nil:
+		migrationProcessor, err = processor.NewFromConfig(ctx, options.ConnConfig, options.Directories, options.Options)
+	case options.DatabaseURL != "":
+		migrationProcessor, err = processor.NewFromURL(ctx, options.DatabaseURL, options.Directories, options.Options)
+	default:
+		migrationProcessor, err = processor.New(ctx, options.Database, options.Directories, options.Options)
+	}
+	if err == nil && options.FS != nil {
+		directories := options.Directories
+		if len(directories) == 0 {
+			directories = []string{"."}
+		}
+		migrationProcessor.Reader = reader.MigrationReaderLocations{
+			FS:        options.FS,
+			Locations: directories,
+		}
+	}
+	return migrationProcessor, err
+}
@@ -0,0 +1,68 @@
+package grotto
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/eaneto/grotto/pkg/connection"
+	"github.com/eaneto/grotto/pkg/processor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateWithCanceledContextShouldReturnConnectionError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := Migrate(ctx, Options{
+		Database: connection.DatabaseInformation{
+			User:     "user",
+			Address:  "localhost",
+			Port:     "5432",
+			Database: "test",
+		},
+		Directories: []string{"migrations"},
+	})
+
+	var connectionError ConnectionError
+	assert.ErrorAs(t, err, &connectionError)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, result)
+}
+
+func TestMigrateWithExistingPoolShouldNotCloseIt(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	dbMock.ExpectQuery("pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+	result, err := Migrate(context.Background(), Options{
+		DB:          db,
+		Directories: []string{"migrations"},
+		Options:     processor.Options{LockTimeout: time.Nanosecond},
+	})
+
+	assert.ErrorIs(t, err, ErrLockTimeout)
+	assert.Empty(t, result.Applied)
+	assert.Nil(t, db.Ping())
+}
+
+func TestValidateWithFileSystemShouldReadTheScriptsFromIt(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	dbMock.ExpectQuery("to_regclass").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	err := Validate(context.Background(), Options{
+		DB: db,
+		FS: fstest.MapFS{
+			"migrations/V1__first.sql":    {Data: []byte("SELECT 1;")},
+			"migrations/1_wrong_name.sql": {Data: []byte("SELECT 2;")},
+		},
+		Directories: []string{"migrations"},
+	})
+
+	assert.Equal(t, ScriptNameError{FileName: "1_wrong_name.sql"}, err)
+}
@@ -0,0 +1,479 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/eaneto/grotto/internal/registry"
+	"github.com/eaneto/grotto/pkg/database"
+	"github.com/sirupsen/logrus"
+)
+
+// Validate Checks that the executed scripts match the scripts on the
+// migration directory, returning a ValidationError with every modified,
+// missing and unknown script. Nothing is changed on the database.
+func (m MigrationProcessorSQL) Validate() error {
+	records, err := m.executedScripts()
+	if err != nil {
+		return err
+	}
+	scripts, err := m.Reader.ReadScriptFiles()
+	if err != nil {
+		return err
+	}
+	err = validateScripts(scripts, records)
+	if err != nil {
+		return err
+	}
+	logrus.Info("Migration validated successfully!")
+	return nil
+}
+
+// Plan Lists the scripts a migration would execute, in execution order,
+// without executing them or creating the migration table. The executed
+// scripts are validated unless the validation is skipped and pending
+// scripts newer than the target are skipped. When the migration would
+// baseline the migration table the scripts up to the baseline version
+// are not pending.
+func (m MigrationProcessorSQL) Plan() ([]database.SQLScript, error) {
+	records, err := m.executedScripts()
+	if err != nil {
+		return nil, err
+	}
+	if m.Options.BaselineOnMigrate {
+		needed, err := m.needsBaseline()
+		if err != nil {
+			return nil, err
+		}
+		if needed {
+			version, description := m.baselineOptions()
+			records = []database.MigrationRecord{{
+				ScriptName:  registry.BASELINE_SCRIPT_NAME,
+				Type:        database.SCRIPT_BASELINE,
+				Version:     version,
+				Description: description,
+				Success:     true,
+			}}
+		}
+	}
+	scripts, err := m.Reader.ReadScriptFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.validateBeforeMigrating(scripts, records)
+	if err != nil {
+		return nil, err
+	}
+	pending, skipped := filterTarget(pendingScripts(scripts, records), records, m.Options.Target)
+	logSkipped(skipped, m.Options.Target)
+	return pending, nil
+}
+
+// pendingScripts Filters the scripts that were not executed successfully
+// yet and the repeatable scripts that changed after their execution.
+// Scripts up to the baseline version are never pending.
+func pendingScripts(scripts []database.SQLScript, records []database.MigrationRecord) []database.SQLScript {
+	executed := make(map[string]database.MigrationRecord, len(records))
+	for _, record := range records {
+		if record.Success {
+			executed[record.ScriptName] = record
+		}
+	}
+
+	baseline := baselineVersion(records)
+	pending := []database.SQLScript{}
+	for _, script := range scripts {
+		if isBelowBaseline(script, baseline) {
+			continue
+		}
+		record, ok := executed[script.Name]
+		if !ok || (script.Type == database.SCRIPT_REPEATABLE && record.Checksum != script.Checksum()) {
+			pending = append(pending, script)
+		}
+	}
+	return pending
+}
+
+// UndoError Some executed scripts can't be undone because their undo
+// script is not on the migration directory.
+type UndoError struct {
+	Missing []string
+}
+
+func (e UndoError) Error() string {
+	return fmt.Sprintf("undo scripts missing for: %s", strings.Join(e.Missing, ", "))
+}
+
+// Undo Executes the undo scripts of the executed versioned scripts newer
+// than the target version, or of the latest executed version without a
+// target, from the newest to the oldest, and removes them from the
+// migration table. Nothing is undone if any of them doesn't have an undo
+// script. Returns the name of the undone scripts.
+func (m MigrationProcessorSQL) Undo() ([]string, error) {
+	err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Locker.Unlock()
+
+	err = m.inTransaction(m.Registry.UpgradeMigrationTable)
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.executedScripts()
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := m.Reader.ReadScriptFiles()
+	if err != nil {
+		return nil, err
+	}
+	scripts, err = undoableScripts(scripts, records, m.Options.Target.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Executor.UndoScripts(scripts)
+	if err != nil {
+		return nil, err
+	}
+	undone := make([]string, len(scripts))
+	for index, script := range scripts {
+		undone[index] = script.Name
+	}
+	return undone, nil
+}
+
+// undoableScripts Lists the scripts that must be undone to go back to
+// the target version, from the newest to the oldest. Returns an UndoError
+// if any of them doesn't have an undo script.
+func undoableScripts(scripts []database.SQLScript, records []database.MigrationRecord,
+	target database.Version) ([]database.SQLScript, error) {
+	executed := []database.MigrationRecord{}
+	for _, record := range records {
+		if record.Success && record.Type == database.SCRIPT_VERSIONED && record.Version != nil {
+			executed = append(executed, record)
+		}
+	}
+	sort.SliceStable(executed, func(i, j int) bool {
+		return executed[i].Version.Compare(executed[j].Version) > 0
+	})
+	if target == nil && len(executed) > 0 {
+		executed = executed[:1]
+	}
+
+	onDisk := make(map[string]database.SQLScript, len(scripts))
+	for _, script := range scripts {
+		onDisk[script.Name] = script
+	}
+
+	undoable := []database.SQLScript{}
+	undoError := UndoError{}
+	for _, record := range executed {
+		if target != nil && record.Version.Compare(target) <= 0 {
+			break
+		}
+		script, ok := onDisk[record.ScriptName]
+		if !ok || script.Undo == nil {
+			undoError.Missing = append(undoError.Missing, record.ScriptName)
+			continue
+		}
+		undoable = append(undoable, script)
+	}
+
+	if len(undoError.Missing) > 0 {
+		return nil, undoError
+	}
+	return undoable, nil
+}
+
+// filterTarget Splits the scripts between the ones up to the target and
+// the name of the pending versioned scripts newer than the target. The
+// current target is the latest executed or baselined version, no
+// versioned script is up to it if none was executed. Repeatable scripts
+// are never skipped.
+func filterTarget(scripts []database.SQLScript, records []database.MigrationRecord,
+	target database.Target) ([]database.SQLScript, []string) {
+	if target.IsLatest() {
+		return scripts, []string{}
+	}
+
+	limit := target.Version
+	if target.Current {
+		for _, record := range records {
+			if record.Success && record.Type != database.SCRIPT_REPEATABLE && record.Version != nil &&
+				(limit == nil || record.Version.Compare(limit) > 0) {
+				limit = record.Version
+			}
+		}
+	}
+
+	pending := map[string]bool{}
+	for _, script := range pendingScripts(scripts, records) {
+		pending[script.Name] = true
+	}
+
+	targeted := []database.SQLScript{}
+	skipped := []string{}
+	for _, script := range scripts {
+		if script.Type == database.SCRIPT_VERSIONED && (limit == nil || script.Version.Compare(limit) > 0) {
+			if pending[script.Name] {
+				skipped = append(skipped, script.Name)
+			}
+			continue
+		}
+		targeted = append(targeted, script)
+	}
+	return targeted, skipped
+}
+
+// logSkipped Logs every pending script skipped because it's newer than
+// the target.
+func logSkipped(skipped []string, target database.Target) {
+	for _, name := range skipped {
+		logrus.WithFields(logrus.Fields{
+			"script_name": name,
+			"target":      target.String(),
+		}).Info("Pending script skipped, it's newer than the target.")
+	}
+}
+
+// Baseline Creates the migration table and inserts the baseline marker
+// with the baseline version, every versioned script up to it is
+// considered executed. Used to adopt an existing database, the migration
+// table must not have any executed script.
+func (m MigrationProcessorSQL) Baseline() error {
+	err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer m.Locker.Unlock()
+
+	return m.baselineInTransaction()
+}
+
+// baselineInTransaction Baselines the migration table in its own
+// transaction.
+func (m MigrationProcessorSQL) baselineInTransaction() error {
+	return m.inTransaction(m.baseline)
+}
+
+// baseline Creates the migration table and inserts the baseline marker
+// if no script was executed yet.
+func (m MigrationProcessorSQL) baseline() error {
+	err := m.Registry.CreateMigrationTable()
+	if err != nil {
+		return err
+	}
+
+	records, err := m.Registry.ExecutedScripts()
+	if err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		return fmt.Errorf("can't baseline, the migration table already has %d executed scripts", len(records))
+	}
+
+	version, description := m.baselineOptions()
+	err = m.Registry.InsertBaseline(version, description)
+	if err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"version":     version.String(),
+		"description": description,
+	}).Info("Migration table baselined.")
+	return nil
+}
+
+// baselineOptions Returns the version and the description of the
+// baseline marker, or their defaults.
+func (m MigrationProcessorSQL) baselineOptions() (database.Version, string) {
+	version := m.Options.BaselineVersion
+	if version == nil {
+		version = DEFAULT_BASELINE_VERSION
+	}
+	description := m.Options.BaselineDescription
+	if description == "" {
+		description = DEFAULT_BASELINE_DESCRIPTION
+	}
+	return version, description
+}
+
+// baselineVersion Returns the version of the baseline marker, nil if
+// the migration table was not baselined.
+func baselineVersion(records []database.MigrationRecord) database.Version {
+	for _, record := range records {
+		if record.Type == database.SCRIPT_BASELINE && record.Success {
+			return record.Version
+		}
+	}
+	return nil
+}
+
+// isBelowBaseline Checks if the script is a versioned script up to the
+// baseline version, which is considered executed.
+func isBelowBaseline(script database.SQLScript, baseline database.Version) bool {
+	return baseline != nil && script.Type == database.SCRIPT_VERSIONED &&
+		script.Version.Compare(baseline) <= 0
+}
+
+// excludeBelowBaseline Removes the scripts up to the baseline version.
+func excludeBelowBaseline(scripts []database.SQLScript, records []database.MigrationRecord) []database.SQLScript {
+	baseline := baselineVersion(records)
+	if baseline == nil {
+		return scripts
+	}
+	remaining := []database.SQLScript{}
+	for _, script := range scripts {
+		if !isBelowBaseline(script, baseline) {
+			remaining = append(remaining, script)
+		}
+	}
+	return remaining
+}
+
+// RepairAction A change on the migration table made by the repair.
+type RepairAction string
+
+const (
+	// REPAIR_REMOVED_FAILED The row of a failed script was removed, the
+	// script is executed again on the next migration.
+	REPAIR_REMOVED_FAILED RepairAction = "Removed failed"
+	// REPAIR_REALIGNED_CHECKSUM The stored checksum of a versioned script
+	// was replaced with the checksum of the script on the directory.
+	REPAIR_REALIGNED_CHECKSUM RepairAction = "Realigned checksum"
+	// REPAIR_MARKED_DELETED The script is no longer on the migration
+	// directory and was marked as deleted.
+	REPAIR_MARKED_DELETED RepairAction = "Marked as deleted"
+)
+
+// RepairChange A single change on the migration table made by the
+// repair.
+type RepairChange struct {
+	ScriptName string
+	Action     RepairAction
+	// What changed, like the old and the new checksum.
+	Detail string
+}
+
+// Repair Fixes the migration table after scripts were edited, deleted
+// or failed: the rows of failed scripts are removed, the checksums of
+// versioned scripts are realigned with the migration directory and the
+// scripts no longer on the migration directory are marked as deleted.
+// Returns every change made.
+func (m MigrationProcessorSQL) Repair() ([]RepairChange, error) {
+	err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Locker.Unlock()
+
+	var changes []RepairChange
+	err = m.inTransaction(func() error {
+		changes, err = m.repairScripts()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// repairScripts Upgrades the migration table, compares every row with
+// the migration directory and fixes the rows that don't match.
+func (m MigrationProcessorSQL) repairScripts() ([]RepairChange, error) {
+	err := m.Registry.UpgradeMigrationTable()
+	if err != nil {
+		return nil, err
+	}
+	records, err := m.executedScripts()
+	if err != nil {
+		return nil, err
+	}
+
+	scripts, err := m.Reader.ReadScriptFiles()
+	if err != nil {
+		return nil, err
+	}
+	onDisk := map[string]database.SQLScript{}
+	for _, script := range scripts {
+		onDisk[script.Name] = script
+	}
+
+	changes := []RepairChange{}
+	for _, record := range records {
+		script, ok := onDisk[record.ScriptName]
+		switch {
+		case !record.Success:
+			err = m.Registry.RemoveScript(record.ScriptName)
+			changes = append(changes, RepairChange{
+				ScriptName: record.ScriptName,
+				Action:     REPAIR_REMOVED_FAILED,
+			})
+		case record.Type == database.SCRIPT_BASELINE || record.Type == database.SCRIPT_DELETED:
+			continue
+		case !ok:
+			err = m.Registry.MarkScriptAsDeleted(record.ScriptName)
+			changes = append(changes, RepairChange{
+				ScriptName: record.ScriptName,
+				Action:     REPAIR_MARKED_DELETED,
+			})
+		case script.Type == database.SCRIPT_VERSIONED && record.Checksum != script.Checksum():
+			err = m.Registry.UpdateChecksum(record.ScriptName, script.Checksum())
+			changes = append(changes, RepairChange{
+				ScriptName: record.ScriptName,
+				Action:     REPAIR_REALIGNED_CHECKSUM,
+				Detail:     fmt.Sprintf("%q -> %q", record.Checksum, script.Checksum()),
+			})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// ErrCleanDisabled The clean was requested without being enabled.
+var ErrCleanDisabled = errors.New("clean is disabled, enable it with -clean-enabled")
+
+// Clean Drops every view, table, sequence, function and type on the
+// clean schemas, including the migration table, in a single transaction.
+// Returns ErrCleanDisabled unless the clean is enabled.
+func (m MigrationProcessorSQL) Clean() ([]string, error) {
+	if !m.Options.CleanEnabled {
+		return nil, ErrCleanDisabled
+	}
+
+	err := m.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Locker.Unlock()
+
+	var dropped []string
+	err = m.inTransaction(func() error {
+		dropped, err = m.Cleaner.Clean()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dropped, nil
+}
+
+// executedScripts Lists the executed scripts, if the migration table
+// doesn't exist yet no script was executed.
+func (m MigrationProcessorSQL) executedScripts() ([]database.MigrationRecord, error) {
+	exists, err := m.Registry.MigrationTableExists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []database.MigrationRecord{}, nil
+	}
+	return m.Registry.ExecutedScripts()
+}
@@ -0,0 +1,1086 @@
+package processor
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/eaneto/grotto/internal/registry"
+	"github.com/eaneto/grotto/pkg/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type RegisterMock struct {
+	mock.Mock
+}
+
+func (m *RegisterMock) CreateMigrationTable() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *RegisterMock) IsScriptAlreadyExecuted(script database.SQLScript) (bool, error) {
+	args := m.Called(script)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *RegisterMock) MarkScriptAsExecuted(script database.SQLScript, executionTime time.Duration) error {
+	args := m.Called(script, executionTime)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) MarkScriptAsFailed(script database.SQLScript, executionTime time.Duration) error {
+	args := m.Called(script, executionTime)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) MigrationTableExists() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *RegisterMock) UpgradeMigrationTable() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *RegisterMock) ExecutedScripts() ([]database.MigrationRecord, error) {
+	args := m.Called()
+	return args.Get(0).([]database.MigrationRecord), args.Error(1)
+}
+
+func (m *RegisterMock) RemoveScript(scriptName string) error {
+	args := m.Called(scriptName)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) UpdateChecksum(scriptName string, checksum string) error {
+	args := m.Called(scriptName, checksum)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) MarkScriptAsDeleted(scriptName string) error {
+	args := m.Called(scriptName)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) InsertBaseline(version database.Version, description string) error {
+	args := m.Called(version, description)
+	return args.Error(0)
+}
+
+func (m *RegisterMock) IsSchemaEmpty() (bool, error) {
+	args := m.Called()
+	return args.Bool(0), args.Error(1)
+}
+
+type CleanerMock struct {
+	mock.Mock
+}
+
+func (m *CleanerMock) Clean() ([]string, error) {
+	args := m.Called()
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func TestInfoShouldListAppliedPendingAndMissingScripts(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	installedOn := time.Now()
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", CreatedAt: installedOn, Success: true},
+		{ScriptName: "V0__deleted.sql", CreatedAt: installedOn, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql"},
+		{Name: "V2__second.sql"},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{
+		{Name: "V1__first.sql", State: STATE_APPLIED, InstalledOn: installedOn},
+		{Name: "V2__second.sql", State: STATE_PENDING},
+		{Name: "V0__deleted.sql", State: STATE_MISSING, InstalledOn: installedOn},
+	}, infos)
+	executorMock.AssertNotCalled(t, "BeginTransaction")
+	registerMock.AssertExpectations(t)
+}
+
+func TestInfoWithChangedRepeatableScriptShouldListItAsOutdated(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	installedOn := time.Now()
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "R__views.sql", Checksum: "old", CreatedAt: installedOn, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Content: "new"},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE, State: STATE_OUTDATED, InstalledOn: installedOn},
+	}, infos)
+}
+
+func TestInfoWithFailedScriptShouldListItAsFailed(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__index.sql", Success: false},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__index.sql", Type: database.SCRIPT_VERSIONED},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, STATE_FAILED, infos[0].State)
+}
+
+func TestInfoWithoutMigrationTableShouldListEveryScriptAsPending(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql"},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{{Name: "V1__first.sql", State: STATE_PENDING}}, infos)
+	registerMock.AssertNotCalled(t, "ExecutedScripts")
+	executorMock.AssertNotCalled(t, "CreateMigrationTable")
+}
+
+func TestInfoWithMigrationTableOnFirstVersionShouldNotUpgradeIt(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherRegexp))
+	defer db.Close()
+	dbMock.ExpectBegin()
+	tx, _ := db.Begin()
+	readerMock := new(ReaderMock)
+
+	installedOn := time.Now()
+	dbMock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + registry.MIGRATION_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	dbMock.ExpectQuery(regexp.QuoteMeta("to_regclass('" + registry.SCHEMA_TABLE_NAME + "')")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	dbMock.ExpectQuery(regexp.QuoteMeta(registry.FIRST_VERSION_EXECUTED_SCRIPTS_QUERY)).
+		WillReturnRows(sqlmock.NewRows([]string{"script_name", "version", "description", "type", "checksum",
+			"installed_by", "created_at", "execution_time_ms", "success"}).
+			AddRow("V1__first.sql", "1", "first", "versioned", "", "user", installedOn, 0, true))
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED},
+		{Name: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registry.MigrationRegisterSQL{Tx: tx},
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{
+		{Name: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED,
+			State: STATE_APPLIED, InstalledOn: installedOn},
+		{Name: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED,
+			State: STATE_PENDING},
+	}, infos)
+	// Nothing else, like creating or altering a table, was executed.
+	assert.Nil(t, dbMock.ExpectationsWereMet())
+}
+
+func TestValidateWithMissingScriptShouldReturnError(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__deleted.sql", Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	err := processor.Validate()
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "V1__deleted.sql")
+}
+
+func TestValidateWithEveryScriptOnDiskShouldNotReturnError(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql"},
+		{Name: "V2__pending.sql"},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	err := processor.Validate()
+
+	assert.Nil(t, err)
+}
+
+func TestPlanShouldListPendingScriptsInExecutionOrder(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "first"},
+		{Name: "V2__failed.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}, Content: "failed"},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}, Content: "third"},
+		{Name: "R__unchanged.sql", Type: database.SCRIPT_REPEATABLE, Content: "unchanged"},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Content: "new"},
+	}
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: scripts[0].Checksum(), Success: true},
+		{ScriptName: "V2__failed.sql", Checksum: scripts[1].Checksum(), Success: false},
+		{ScriptName: "R__unchanged.sql", Checksum: scripts[3].Checksum(), Success: true},
+		{ScriptName: "R__views.sql", Checksum: "old", Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	pending, err := processor.Plan()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []database.SQLScript{scripts[1], scripts[2], scripts[4]}, pending)
+	executorMock.AssertNotCalled(t, "CreateMigrationTable")
+	executorMock.AssertNotCalled(t, "ProcessScripts", mock.Anything)
+}
+
+func TestPlanWithoutMigrationTableShouldListEveryScriptWithoutCreatingIt(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{{Name: "V1__first.sql"}}
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	pending, err := processor.Plan()
+
+	assert.Nil(t, err)
+	assert.Equal(t, scripts, pending)
+	executorMock.AssertNotCalled(t, "CreateMigrationTable")
+	registerMock.AssertNotCalled(t, "CreateMigrationTable")
+}
+
+func TestPlanWithModifiedScriptShouldReturnValidationError(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: "old", Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "new"},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	pending, err := processor.Plan()
+
+	assert.IsType(t, ValidationError{}, err)
+	assert.Nil(t, pending)
+}
+
+func TestPlanWithTargetShouldSkipPendingScriptsNewerThanTheTarget(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE},
+	}
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+		Options:  Options{Target: database.Target{Version: database.Version{2}}},
+	}
+
+	pending, err := processor.Plan()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []database.SQLScript{scripts[0], scripts[1], scripts[3]}, pending)
+}
+
+func TestFilterTargetShouldReportOnlyPendingScriptsAsSkipped(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Success: true},
+		{ScriptName: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}, Success: true},
+	}
+
+	targeted, skipped := filterTarget(scripts, records, database.Target{Version: database.Version{1}})
+
+	assert.Equal(t, scripts[:1], targeted)
+	assert.Equal(t, []string{"V3__third.sql"}, skipped)
+}
+
+func TestFilterCurrentTargetShouldSkipVersionsNewerThanTheLatestExecuted(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Success: true},
+	}
+
+	targeted, skipped := filterTarget(scripts, records, database.Target{Current: true})
+
+	assert.Equal(t, []database.SQLScript{scripts[0], scripts[2]}, targeted)
+	assert.Equal(t, []string{"V2__second.sql"}, skipped)
+}
+
+func TestFilterCurrentTargetWithoutExecutedScriptsShouldSkipEveryVersionedScript(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE},
+	}
+
+	targeted, skipped := filterTarget(scripts, []database.MigrationRecord{}, database.Target{Current: true})
+
+	assert.Equal(t, scripts[1:], targeted)
+	assert.Equal(t, []string{"V1__first.sql"}, skipped)
+}
+
+func TestUndoWithoutTargetShouldUndoOnlyTheLatestVersion(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}, Undo: &database.SQLScript{Name: "U1__first.sql"}},
+		{Name: "V2__second.sql", Version: database.Version{2}, Undo: &database.SQLScript{Name: "U2__second.sql"}},
+	}
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	executorMock.On("UndoScripts", []database.SQLScript{scripts[1]}).Return(nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	undone, err := processor.Undo()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"V2__second.sql"}, undone)
+	executorMock.AssertExpectations(t)
+	registerMock.AssertCalled(t, "UpgradeMigrationTable")
+}
+
+func TestUndoWithTargetShouldUndoNewerVersionsFromTheNewest(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}},
+		{Name: "V1.1__second.sql", Version: database.Version{1, 1}, Undo: &database.SQLScript{Name: "U1.1__second.sql"}},
+		{Name: "V2__third.sql", Version: database.Version{2}, Undo: &database.SQLScript{Name: "U2__third.sql"}},
+	}
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V1.1__second.sql", Version: database.Version{1, 1}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V2__third.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	executorMock.On("UndoScripts", []database.SQLScript{scripts[2], scripts[1]}).Return(nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{Target: database.Target{Version: database.Version{1}}},
+	}
+
+	undone, err := processor.Undo()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"V2__third.sql", "V1.1__second.sql"}, undone)
+	executorMock.AssertExpectations(t)
+}
+
+func TestUndoWithMissingUndoScriptShouldNotUndoAnything(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V3__deleted.sql", Version: database.Version{3}, Type: database.SCRIPT_VERSIONED, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}},
+		{Name: "V2__second.sql", Version: database.Version{2}, Undo: &database.SQLScript{Name: "U2__second.sql"}},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{Target: database.Target{Version: database.Version{0}}},
+	}
+
+	undone, err := processor.Undo()
+
+	assert.Equal(t, UndoError{Missing: []string{"V3__deleted.sql", "V1__first.sql"}}, err)
+	assert.Nil(t, undone)
+	executorMock.AssertNotCalled(t, "UndoScripts", mock.Anything)
+}
+
+func TestBaselineShouldInsertTheBaselineMarkerAndCommit(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("CreateMigrationTable").Return(nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+	registerMock.On("InsertBaseline", database.Version{40}, "legacy").Return(nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{BaselineVersion: database.Version{40}, BaselineDescription: "legacy"},
+	}
+
+	err := processor.Baseline()
+
+	assert.Nil(t, err)
+	executorMock.AssertExpectations(t)
+	executorMock.AssertNotCalled(t, "ProcessScripts", mock.Anything)
+	registerMock.AssertExpectations(t)
+}
+
+func TestBaselineWithoutVersionShouldUseTheDefaultVersion(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("CreateMigrationTable").Return(nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+	registerMock.On("InsertBaseline", DEFAULT_BASELINE_VERSION, DEFAULT_BASELINE_DESCRIPTION).Return(nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	err := processor.Baseline()
+
+	assert.Nil(t, err)
+	registerMock.AssertExpectations(t)
+}
+
+func TestBaselineWithExecutedScriptsShouldRollbackTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("RollbackTransaction").Return(nil)
+	registerMock.On("CreateMigrationTable").Return(nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Success: true},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	err := processor.Baseline()
+
+	assert.NotNil(t, err)
+	executorMock.AssertNotCalled(t, "CommitTransaction")
+	registerMock.AssertNotCalled(t, "InsertBaseline", mock.Anything, mock.Anything)
+}
+
+func TestBaselineWithErrorShouldRollbackTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	registerMock := new(RegisterMock)
+
+	expectedError := errors.New("Error creating table")
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("RollbackTransaction").Return(nil)
+	registerMock.On("CreateMigrationTable").Return(expectedError)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	actualError := processor.Baseline()
+
+	assert.Equal(t, expectedError, actualError)
+	executorMock.AssertExpectations(t)
+	executorMock.AssertNotCalled(t, "CommitTransaction")
+}
+
+func TestInfoWithBaselineShouldListScriptsUpToItAsBelowBaseline(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	installedOn := time.Now()
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{
+			ScriptName: "<< Grotto Baseline >>",
+			Type:       database.SCRIPT_BASELINE,
+			Version:    database.Version{2},
+			CreatedAt:  installedOn,
+			Success:    true,
+		},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{
+		{Name: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED, State: STATE_BELOW_BASELINE},
+		{Name: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, State: STATE_BELOW_BASELINE},
+		{Name: "V3__third.sql", Version: database.Version{3}, Type: database.SCRIPT_VERSIONED, State: STATE_PENDING},
+		{
+			Name:        "<< Grotto Baseline >>",
+			Version:     database.Version{2},
+			Type:        database.SCRIPT_BASELINE,
+			State:       STATE_BASELINE,
+			InstalledOn: installedOn,
+		},
+	}, infos)
+}
+
+func TestPlanWithBaselineOnMigrateShouldNotListScriptsUpToTheBaseline(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+	}
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	registerMock.On("IsSchemaEmpty").Return(false, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+		Options:  Options{BaselineOnMigrate: true},
+	}
+
+	pending, err := processor.Plan()
+
+	assert.Nil(t, err)
+	assert.Equal(t, scripts[1:], pending)
+	registerMock.AssertNotCalled(t, "InsertBaseline", mock.Anything, mock.Anything)
+}
+
+func TestRepairShouldKeepTheBaselineMarker(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "<< Grotto Baseline >>", Type: database.SCRIPT_BASELINE, Version: database.Version{1}, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	changes, err := processor.Repair()
+
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+	registerMock.AssertNotCalled(t, "MarkScriptAsDeleted", mock.Anything)
+}
+
+func TestRepairWithErrorCommittingShouldReturnError(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	expectedError := errors.New("connection reset")
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(expectedError)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	changes, err := processor.Repair()
+
+	assert.Equal(t, expectedError, err)
+	assert.Nil(t, changes)
+}
+
+func TestRepairShouldFixEveryRowThatDoesNotMatchTheDirectoryAndCommit(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Content: "first"},
+		{Name: "V2__edited.sql", Type: database.SCRIPT_VERSIONED, Content: "fixed comment"},
+		{Name: "V3__failed.sql", Type: database.SCRIPT_VERSIONED, Content: "failed"},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Content: "new views"},
+	}
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: scripts[0].Checksum(), Success: true},
+		{ScriptName: "V2__edited.sql", Checksum: "old", Success: true},
+		{ScriptName: "V3__failed.sql", Checksum: scripts[2].Checksum(), Success: false},
+		{ScriptName: "V4__removed.sql", Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V0__gone.sql", Type: database.SCRIPT_DELETED, Success: true},
+		{ScriptName: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Checksum: "old views", Success: true},
+	}, nil)
+	registerMock.On("UpdateChecksum", "V2__edited.sql", scripts[1].Checksum()).Return(nil)
+	registerMock.On("RemoveScript", "V3__failed.sql").Return(nil)
+	registerMock.On("MarkScriptAsDeleted", "V4__removed.sql").Return(nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	changes, err := processor.Repair()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []RepairChange{
+		{
+			ScriptName: "V2__edited.sql",
+			Action:     REPAIR_REALIGNED_CHECKSUM,
+			Detail:     `"old" -> "` + scripts[1].Checksum() + `"`,
+		},
+		{ScriptName: "V3__failed.sql", Action: REPAIR_REMOVED_FAILED},
+		{ScriptName: "V4__removed.sql", Action: REPAIR_MARKED_DELETED},
+	}, changes)
+	executorMock.AssertExpectations(t)
+	registerMock.AssertExpectations(t)
+	registerMock.AssertNumberOfCalls(t, "UpdateChecksum", 1)
+}
+
+func TestRepairWithErrorShouldRollbackTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	expectedError := errors.New("connection closed")
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("RollbackTransaction").Return(nil)
+	registerMock.On("UpgradeMigrationTable").Return(nil)
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__deleted.sql", Success: true},
+	}, nil)
+	registerMock.On("MarkScriptAsDeleted", "V1__deleted.sql").Return(expectedError)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	changes, err := processor.Repair()
+
+	assert.Equal(t, expectedError, err)
+	assert.Nil(t, changes)
+	executorMock.AssertExpectations(t)
+	executorMock.AssertNotCalled(t, "CommitTransaction")
+}
+
+func TestInfoWithDeletedScriptShouldListItAsDeleted(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__gone.sql", Type: database.SCRIPT_DELETED, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{{Name: "V1__gone.sql", Type: database.SCRIPT_DELETED, State: STATE_DELETED}}, infos)
+}
+
+func TestInfoShouldListTheDetailsOfEveryScript(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	installedOn := time.Now()
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{
+			ScriptName:    "V1__create_users.sql",
+			Version:       database.Version{1},
+			Description:   "create users",
+			Type:          database.SCRIPT_VERSIONED,
+			CreatedAt:     installedOn,
+			ExecutionTime: 15 * time.Millisecond,
+			Success:       true,
+		},
+		{
+			ScriptName:    "V0__removed.sql",
+			Version:       database.Version{0},
+			Description:   "removed",
+			Type:          database.SCRIPT_VERSIONED,
+			CreatedAt:     installedOn,
+			ExecutionTime: time.Millisecond,
+			Success:       true,
+		},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__create_users.sql", Version: database.Version{1}, Description: "create users", Type: database.SCRIPT_VERSIONED},
+		{Name: "R__views.sql", Description: "views", Type: database.SCRIPT_REPEATABLE},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []ScriptInfo{
+		{
+			Name:          "V1__create_users.sql",
+			Version:       database.Version{1},
+			Description:   "create users",
+			Type:          database.SCRIPT_VERSIONED,
+			State:         STATE_APPLIED,
+			InstalledOn:   installedOn,
+			ExecutionTime: 15 * time.Millisecond,
+		},
+		{Name: "R__views.sql", Description: "views", Type: database.SCRIPT_REPEATABLE, State: STATE_PENDING},
+		{
+			Name:          "V0__removed.sql",
+			Version:       database.Version{0},
+			Description:   "removed",
+			Type:          database.SCRIPT_VERSIONED,
+			State:         STATE_MISSING,
+			InstalledOn:   installedOn,
+			ExecutionTime: time.Millisecond,
+		},
+	}, infos)
+}
+
+func TestInfoWithPendingScriptOlderThanTheLatestShouldListItAsIgnored(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED},
+		{Name: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED},
+		{Name: "V3__third.sql", Version: database.Version{3}, Type: database.SCRIPT_VERSIONED},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, STATE_IGNORED, infos[0].State)
+	assert.Equal(t, STATE_APPLIED, infos[1].State)
+	assert.Equal(t, STATE_PENDING, infos[2].State)
+}
+
+func TestInfoWithScriptExecutedAfterANewerVersionShouldListItAsOutOfOrder(t *testing.T) {
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	registerMock.On("MigrationTableExists").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V3__third.sql", Version: database.Version{3}, Type: database.SCRIPT_VERSIONED, Success: true},
+		{ScriptName: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED, Success: true},
+	}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Version: database.Version{1}, Type: database.SCRIPT_VERSIONED},
+		{Name: "V2__second.sql", Version: database.Version{2}, Type: database.SCRIPT_VERSIONED},
+		{Name: "V3__third.sql", Version: database.Version{3}, Type: database.SCRIPT_VERSIONED},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Reader:   readerMock,
+		Registry: registerMock,
+	}
+
+	infos, err := processor.Info()
+
+	assert.Nil(t, err)
+	assert.Equal(t, STATE_APPLIED, infos[0].State)
+	assert.Equal(t, STATE_OUT_OF_ORDER, infos[1].State)
+	assert.Equal(t, STATE_APPLIED, infos[2].State)
+}
+
+func TestCleanWithErrorShouldRollbackTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	cleanerMock := new(CleanerMock)
+
+	expectedError := errors.New("Error dropping tables")
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("RollbackTransaction").Return(nil)
+	cleanerMock.On("Clean").Return([]string{}, expectedError)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Cleaner:  cleanerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{CleanEnabled: true},
+	}
+
+	dropped, actualError := processor.Clean()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.Nil(t, dropped)
+	executorMock.AssertExpectations(t)
+	executorMock.AssertNotCalled(t, "CommitTransaction")
+}
+
+func TestCleanWithSuccessShouldCommitTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	cleanerMock := new(CleanerMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	cleanerMock.On("Clean").Return([]string{"users"}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Cleaner:  cleanerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{CleanEnabled: true},
+	}
+
+	dropped, err := processor.Clean()
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"users"}, dropped)
+	executorMock.AssertExpectations(t)
+}
+
+func TestCleanWithErrorBeginningTransactionShouldNotClean(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	cleanerMock := new(CleanerMock)
+
+	expectedError := errors.New("Error starting transaction")
+	executorMock.On("BeginTransaction").Return(expectedError)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Cleaner:  cleanerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{CleanEnabled: true},
+	}
+
+	dropped, actualError := processor.Clean()
+
+	assert.Equal(t, expectedError, actualError)
+	assert.Nil(t, dropped)
+	cleanerMock.AssertNotCalled(t, "Clean")
+}
+
+func TestCleanDisabledShouldNotClean(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	cleanerMock := new(CleanerMock)
+	lockerMock := new(LockerMock)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Cleaner:  cleanerMock,
+		Locker:   lockerMock,
+	}
+
+	dropped, err := processor.Clean()
+
+	assert.Equal(t, ErrCleanDisabled, err)
+	assert.Nil(t, dropped)
+	lockerMock.AssertNotCalled(t, "Lock", mock.Anything)
+	executorMock.AssertNotCalled(t, "BeginTransaction")
+	cleanerMock.AssertNotCalled(t, "Clean")
+}
+
+func TestRepairWithLockTimeoutShouldNotBeginTransaction(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	lockerMock := new(LockerMock)
+
+	expectedError := errors.New("timed out")
+	lockerMock.On("Lock", mock.Anything).Return(expectedError)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Locker:   lockerMock,
+	}
+
+	changes, err := processor.Repair()
+
+	assert.Equal(t, expectedError, err)
+	assert.Nil(t, changes)
+	executorMock.AssertNotCalled(t, "BeginTransaction")
+}
@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/eaneto/grotto/pkg/database"
+)
+
+// ScriptState The state of a script compared to the migration table.
+type ScriptState string
+
+const (
+	// STATE_APPLIED The script was already executed.
+	STATE_APPLIED ScriptState = "Applied"
+	// STATE_PENDING The script was not executed yet.
+	STATE_PENDING ScriptState = "Pending"
+	// STATE_MISSING The script was executed but is no longer on the
+	// migration directory.
+	STATE_MISSING ScriptState = "Missing"
+	// STATE_OUTDATED The repeatable script changed after its last
+	// execution and will be executed again.
+	STATE_OUTDATED ScriptState = "Outdated"
+	// STATE_FAILED The script failed outside a transaction and may be
+	// partially applied, it will be executed again.
+	STATE_FAILED ScriptState = "Failed"
+	// STATE_IGNORED The versioned script was not executed but is older
+	// than the latest executed version, the validation fails until it's
+	// executed or removed.
+	STATE_IGNORED ScriptState = "Ignored"
+	// STATE_OUT_OF_ORDER The versioned script was executed after a newer
+	// version, like when the validation was skipped.
+	STATE_OUT_OF_ORDER ScriptState = "Out-of-order"
+	// STATE_DELETED The script was deleted from the migration directory
+	// and marked as deleted by the repair.
+	STATE_DELETED ScriptState = "Deleted"
+	// STATE_BASELINE The baseline marker on the migration table.
+	STATE_BASELINE ScriptState = "Baseline"
+	// STATE_BELOW_BASELINE The versioned script is up to the baseline
+	// version, it's considered executed.
+	STATE_BELOW_BASELINE ScriptState = "Below baseline"
+)
+
+// ScriptInfo The information of a single script, either read from the
+// migration directory or from the migration table.
+type ScriptInfo struct {
+	Name string
+	// The version of versioned scripts and of the baseline, nil
+	// otherwise.
+	Version     database.Version
+	Description string
+	Type        database.ScriptType
+	State       ScriptState
+	// The date the script was executed, zero if it's pending.
+	InstalledOn time.Time
+	// How long the last execution took, zero if it's pending.
+	ExecutionTime time.Duration
+}
+
+// Info Lists every script on the migration directory and on the
+// migration table with its current state. Nothing is changed on the
+// database.
+func (m MigrationProcessorSQL) Info() ([]ScriptInfo, error) {
+	records, err := m.executedScripts()
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := m.Reader.ReadScriptFiles()
+	if err != nil {
+		return nil, err
+	}
+	return scriptInfos(scripts, records), nil
+}
+
+// scriptInfos Joins the scripts on the migration directory, in execution
+// order, with the executed scripts, followed by the executed scripts no
+// longer on the migration directory.
+func scriptInfos(scripts []database.SQLScript, records []database.MigrationRecord) []ScriptInfo {
+	executed := make(map[string]database.MigrationRecord, len(records))
+	for _, record := range records {
+		executed[record.ScriptName] = record
+	}
+	outOfOrder := outOfOrderScripts(records)
+	latest := latestExecutedVersion(records)
+	baseline := baselineVersion(records)
+
+	infos := []ScriptInfo{}
+	onDisk := make(map[string]bool, len(scripts))
+	for _, script := range scripts {
+		onDisk[script.Name] = true
+		info := ScriptInfo{
+			Name:        script.Name,
+			Version:     script.Version,
+			Description: script.Description,
+			Type:        script.Type,
+			State:       STATE_PENDING,
+		}
+		record, ok := executed[script.Name]
+		switch {
+		case isBelowBaseline(script, baseline):
+			info.State = STATE_BELOW_BASELINE
+		case !ok:
+			if script.Type == database.SCRIPT_VERSIONED && latest != nil && script.Version.Compare(latest) < 0 {
+				info.State = STATE_IGNORED
+			}
+		default:
+			info.InstalledOn = record.CreatedAt
+			info.ExecutionTime = record.ExecutionTime
+			switch {
+			case !record.Success:
+				info.State = STATE_FAILED
+			case script.Type == database.SCRIPT_REPEATABLE && record.Checksum != script.Checksum():
+				info.State = STATE_OUTDATED
+			case outOfOrder[script.Name]:
+				info.State = STATE_OUT_OF_ORDER
+			default:
+				info.State = STATE_APPLIED
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	for _, record := range records {
+		if onDisk[record.ScriptName] {
+			continue
+		}
+		state := STATE_MISSING
+		if record.Type == database.SCRIPT_BASELINE {
+			state = STATE_BASELINE
+		} else if record.Type == database.SCRIPT_DELETED {
+			state = STATE_DELETED
+		}
+		infos = append(infos, ScriptInfo{
+			Name:          record.ScriptName,
+			Version:       record.Version,
+			Description:   record.Description,
+			Type:          record.Type,
+			State:         state,
+			InstalledOn:   record.CreatedAt,
+			ExecutionTime: record.ExecutionTime,
+		})
+	}
+	return infos
+}
+
+// latestExecutedVersion Returns the latest version executed successfully
+// or baselined, nil if there is none.
+func latestExecutedVersion(records []database.MigrationRecord) database.Version {
+	var latest database.Version
+	for _, record := range records {
+		if !record.Success || record.Version == nil ||
+			(record.Type != database.SCRIPT_VERSIONED && record.Type != database.SCRIPT_BASELINE) {
+			continue
+		}
+		if latest == nil || record.Version.Compare(latest) > 0 {
+			latest = record.Version
+		}
+	}
+	return latest
+}
+
+// outOfOrderScripts Returns the versioned scripts executed after a
+// newer version, the records must be in execution order.
+func outOfOrderScripts(records []database.MigrationRecord) map[string]bool {
+	outOfOrder := map[string]bool{}
+	var latest database.Version
+	for _, record := range records {
+		if !record.Success || record.Type != database.SCRIPT_VERSIONED || record.Version == nil {
+			continue
+		}
+		if latest != nil && record.Version.Compare(latest) < 0 {
+			outOfOrder[record.ScriptName] = true
+		} else {
+			latest = record.Version
+		}
+	}
+	return outOfOrder
+}
@@ -1,12 +1,16 @@
 package processor
 
 import (
+	"context"
 	"errors"
+	"io/fs"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/eaneto/grotto/pkg/connection"
 	"github.com/eaneto/grotto/pkg/database"
-	"github.com/sirupsen/logrus"
+	"github.com/jackc/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -20,117 +24,544 @@ func (m *ScriptExecutorMock) CreateMigrationTable() error {
 	return args.Error(0)
 }
 
-func (m *ScriptExecutorMock) ProcessScripts(scripts []database.SQLScript) error {
+func (m *ScriptExecutorMock) ProcessScripts(scripts []database.SQLScript) ([]database.MigrationRecord, error) {
+	args := m.Called(scripts)
+	return args.Get(0).([]database.MigrationRecord), args.Error(1)
+}
+
+func (m *ScriptExecutorMock) UndoScripts(scripts []database.SQLScript) error {
+	args := m.Called(scripts)
+	return args.Error(0)
+}
+
+func (m *ScriptExecutorMock) BeginTransaction() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+func (m *ScriptExecutorMock) RollbackTransaction() error {
 	args := m.Called()
 	return args.Error(0)
 }
 
-func (m *ScriptExecutorMock) RollbackTransaction() {
-	m.Called()
+func (m *ScriptExecutorMock) CommitTransaction() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+type LockerMock struct {
+	mock.Mock
+}
+
+func (m *LockerMock) Lock(timeout time.Duration) error {
+	args := m.Called(timeout)
+	return args.Error(0)
+}
+
+func (m *LockerMock) Unlock() error {
+	args := m.Called()
+	return args.Error(0)
 }
 
-func (m *ScriptExecutorMock) CommitTransaction() {
-	m.Called()
+// newLockerMock Creates a locker that always acquires the lock.
+func newLockerMock() *LockerMock {
+	lockerMock := new(LockerMock)
+	lockerMock.On("Lock", mock.Anything).Return(nil)
+	lockerMock.On("Unlock").Return(nil)
+	return lockerMock
 }
 
 type ReaderMock struct {
 	mock.Mock
 }
 
-func (m *ReaderMock) ReadScriptFiles() []database.SQLScript {
+func (m *ReaderMock) ReadScriptFiles() ([]database.SQLScript, error) {
 	args := m.Called()
-	return args.Get(0).([]database.SQLScript)
+	return args.Get(0).([]database.SQLScript), args.Error(1)
 }
 
-func TestProcessingWithNoScriptsReturnedByReaderShouldCommitTransaction(t *testing.T) {
+func TestProcessingWithNoScriptsReturnedByReaderShouldProcessScripts(t *testing.T) {
 	executorMock := new(ScriptExecutorMock)
 	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
 
 	executorMock.On("CreateMigrationTable").Return(nil)
-	executorMock.On("ProcessScripts", mock.Anything).Return(nil)
-	executorMock.On("CommitTransaction").Return(nil)
-	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{})
+	executorMock.On("ProcessScripts", mock.Anything).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
 
 	processor := MigrationProcessorSQL{
 		Executor: executorMock,
 		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
 	}
 
 	processor.ProcessMigration()
 
 	executorMock.AssertExpectations(t)
-	executorMock.AssertNotCalled(t, "RollbackTransaction")
+	executorMock.AssertNotCalled(t, "BeginTransaction")
 	readerMock.AssertExpectations(t)
 }
 
-func TestProcessingWithErrorShouldRollbackTransaction(t *testing.T) {
+func TestProcessingWithErrorShouldLeaveTransactionsToTheExecutor(t *testing.T) {
 	executorMock := new(ScriptExecutorMock)
 	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
 
 	executorMock.On("CreateMigrationTable").Return(nil)
-	executorMock.On("ProcessScripts", mock.Anything).Return(errors.New(""))
-	executorMock.On("RollbackTransaction").Return(nil)
-	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{})
+	expectedError := errors.New("syntax error")
+	executorMock.On("ProcessScripts", mock.Anything).Return([]database.MigrationRecord{}, expectedError)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
 
 	processor := MigrationProcessorSQL{
 		Executor: executorMock,
 		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
 	}
 
-	processor.ProcessMigration()
+	_, err := processor.ProcessMigration()
+
+	assert.Equal(t, expectedError, err)
 
 	executorMock.AssertExpectations(t)
 	executorMock.AssertNotCalled(t, "CommitTransaction")
+	executorMock.AssertNotCalled(t, "RollbackTransaction")
 	readerMock.AssertExpectations(t)
 }
 
-func TestProcessingWithErrorCreatingMigrationTableShouldRollbackTransaction(t *testing.T) {
+func TestProcessingWithErrorCreatingMigrationTableShouldNotReadScripts(t *testing.T) {
 	executorMock := new(ScriptExecutorMock)
 	readerMock := new(ReaderMock)
 
-	executorMock.On("CreateMigrationTable").Return(errors.New(""))
-	executorMock.On("RollbackTransaction").Panic("Panic")
+	expectedError := errors.New("permission denied")
+	executorMock.On("CreateMigrationTable").Return(expectedError)
 
 	processor := MigrationProcessorSQL{
 		Executor: executorMock,
 		Reader:   readerMock,
+		Locker:   newLockerMock(),
 	}
 
-	assert.Panics(t, processor.ProcessMigration)
+	_, err := processor.ProcessMigration()
+
+	assert.ErrorIs(t, err, expectedError)
 
 	executorMock.AssertExpectations(t)
-	executorMock.AssertNotCalled(t, "CommitTransaction")
-	executorMock.AssertNotCalled(t, "ProcessScript", mock.Anything)
+	executorMock.AssertNotCalled(t, "ProcessScripts", mock.Anything)
 	readerMock.AssertNotCalled(t, "ReadScriptFiles")
 }
 
-func TestInitializeExecutorWithSuccessShouldBeginDatabaseConnection(t *testing.T) {
+func TestProcessingWithModifiedScriptShouldNotProcessScripts(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("CreateMigrationTable").Return(nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Content: "edited"},
+	}, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: "original", Success: true},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	_, err := processor.ProcessMigration()
+
+	var validationError ValidationError
+	assert.ErrorAs(t, err, &validationError)
+	assert.Equal(t, []string{"V1__first.sql"}, validationError.Modified)
+
+	executorMock.AssertExpectations(t)
+	executorMock.AssertNotCalled(t, "ProcessScripts", mock.Anything)
+}
+
+func TestProcessingWithSkipValidationShouldProcessModifiedScripts(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "new"},
+	}
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", scripts).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: "old", Success: true},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Options:  Options{SkipValidation: true},
+		Locker:   newLockerMock(),
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertExpectations(t)
+}
+
+func TestProcessingWithBaselineShouldNotProcessScriptsUpToIt(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+	}
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", scripts[1:]).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "<< Grotto Baseline >>", Type: database.SCRIPT_BASELINE, Version: database.Version{1}, Success: true},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertExpectations(t)
+}
+
+func TestProcessingWithBaselineOnMigrateOnNonEmptySchemaShouldBaselineFirst(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("BeginTransaction").Return(nil)
+	executorMock.On("CommitTransaction").Return(nil)
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", []database.SQLScript{}).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+	}, nil)
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	registerMock.On("IsSchemaEmpty").Return(false, nil)
+	registerMock.On("CreateMigrationTable").Return(nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil).Once()
+	registerMock.On("InsertBaseline", database.Version{1}, DEFAULT_BASELINE_DESCRIPTION).Return(nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{
+		{ScriptName: "<< Grotto Baseline >>", Type: database.SCRIPT_BASELINE, Version: database.Version{1}, Success: true},
+	}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{BaselineOnMigrate: true},
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertExpectations(t)
+	registerMock.AssertExpectations(t)
+}
+
+func TestProcessingWithBaselineOnMigrateOnEmptySchemaShouldNotBaseline(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", mock.Anything).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+	registerMock.On("MigrationTableExists").Return(false, nil)
+	registerMock.On("IsSchemaEmpty").Return(true, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{BaselineOnMigrate: true},
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertNotCalled(t, "BeginTransaction")
+	registerMock.AssertNotCalled(t, "InsertBaseline", mock.Anything, mock.Anything)
+}
+
+func TestProcessingShouldHoldTheLockDuringTheMigration(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+	lockerMock := newLockerMock()
+
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", mock.Anything).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   lockerMock,
+		Options:  Options{LockTimeout: time.Second},
+	}
+
+	processor.ProcessMigration()
+
+	lockerMock.AssertCalled(t, "Lock", time.Second)
+	lockerMock.AssertCalled(t, "Unlock")
+	executorMock.AssertExpectations(t)
+}
+
+func TestProcessingWithoutLockTimeoutShouldWaitTheDefaultTimeout(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+	lockerMock := newLockerMock()
+
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", mock.Anything).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript{}, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   lockerMock,
+	}
+
+	processor.ProcessMigration()
+
+	lockerMock.AssertCalled(t, "Lock", DEFAULT_LOCK_TIMEOUT)
+}
+
+func TestProcessingWithLockTimeoutShouldNotReadState(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	lockerMock := new(LockerMock)
+
+	lockerMock.On("Lock", mock.Anything).Return(errors.New("timed out"))
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Locker:   lockerMock,
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertNotCalled(t, "CreateMigrationTable")
+	readerMock.AssertNotCalled(t, "ReadScriptFiles")
+	lockerMock.AssertNotCalled(t, "Unlock")
+}
+
+func TestProcessingWithTargetShouldProcessOnlyScriptsUpToTheTarget(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+	}
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", scripts[:1]).Return([]database.MigrationRecord{}, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{Target: database.Target{Version: database.Version{1}}},
+	}
+
+	processor.ProcessMigration()
+
+	executorMock.AssertExpectations(t)
+}
+
+func TestInitializeExecutorWithSuccessShouldReserveConnectionWithoutTransaction(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
-	dbMock.ExpectBegin()
 
-	initializeExecutor(db)
+	scriptExecutor, err := initializeExecutor(context.Background(), db, "")
+
+	assert.Nil(t, err)
+	assert.NotNil(t, scriptExecutor.Session)
+	assert.False(t, scriptExecutor.Session.InTransaction())
+	assert.Equal(t, database.TRANSACTION_PER_SCRIPT, scriptExecutor.TransactionMode)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestInitializeExecutorWithErrorShouldReturnConnectionError(t *testing.T) {
+	db, dbMock, _ := sqlmock.New()
+	db.Close()
+
+	_, err := initializeExecutor(context.Background(), db, database.TRANSACTION_ALL)
 
+	var connectionError ConnectionError
+	assert.ErrorAs(t, err, &connectionError)
 	assertDatabaseExpectations(t, dbMock)
 }
 
-func TestInitializeExecutorWithErrorShouldPanic(t *testing.T) {
+func TestProcessingShouldReturnTheAppliedAndSkippedScripts(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+	registerMock := new(RegisterMock)
+
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+	}
+	applied := []database.MigrationRecord{
+		{ScriptName: "V1__first.sql", ExecutionTime: time.Second, Success: true},
+	}
+	executorMock.On("CreateMigrationTable").Return(nil)
+	executorMock.On("ProcessScripts", scripts[:1]).Return(applied, nil)
+	readerMock.On("ReadScriptFiles").Return(scripts, nil)
+	registerMock.On("ExecutedScripts").Return([]database.MigrationRecord{}, nil)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Registry: registerMock,
+		Locker:   newLockerMock(),
+		Options:  Options{Target: database.Target{Version: database.Version{1}}},
+	}
+
+	result, err := processor.ProcessMigration()
+
+	assert.Nil(t, err)
+	assert.Equal(t, MigrationResult{Applied: applied, Skipped: []string{"V2__second.sql"}}, result)
+}
+
+func TestProcessingWithErrorReadingScriptsShouldNotProcessScripts(t *testing.T) {
+	executorMock := new(ScriptExecutorMock)
+	readerMock := new(ReaderMock)
+
+	expectedError := errors.New("permission denied")
+	executorMock.On("CreateMigrationTable").Return(nil)
+	readerMock.On("ReadScriptFiles").Return([]database.SQLScript(nil), expectedError)
+
+	processor := MigrationProcessorSQL{
+		Executor: executorMock,
+		Reader:   readerMock,
+		Locker:   newLockerMock(),
+	}
+
+	_, err := processor.ProcessMigration()
+
+	assert.Equal(t, expectedError, err)
+	executorMock.AssertNotCalled(t, "ProcessScripts", mock.Anything)
+}
+
+func TestNewFromDBShouldNotCloseThePoolOnClose(t *testing.T) {
 	db, dbMock, _ := sqlmock.New()
 	defer db.Close()
-	dbMock.ExpectBegin().WillReturnError(errors.New("Error"))
 
-	// Changes the logger for a mock that changes the value of fatal
-	// to true if the log was fatal.
-	defer func() { logrus.StandardLogger().ExitFunc = nil }()
-	var fatal bool
-	logrus.StandardLogger().ExitFunc = func(int) { fatal = true }
+	processor, err := NewFromDB(context.Background(), db, []string{"migrations"}, Options{})
+
+	assert.Nil(t, err)
+	assert.Nil(t, processor.Close())
+	assert.Nil(t, db.Ping())
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestNewFromDBShouldRetryTheConnectionUntilTheDatabaseAcceptsIt(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	defer db.Close()
+	dbMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	dbMock.ExpectPing().WillReturnError(&pgconn.PgError{Code: CANNOT_CONNECT_NOW})
+	dbMock.ExpectPing()
+
+	processor, err := NewFromDB(context.Background(), db, []string{"migrations"}, Options{
+		ConnectRetries: 2,
+		ConnectBackoff: time.Millisecond,
+	})
 
-	initializeExecutor(db)
+	assert.Nil(t, err)
+	assert.Nil(t, processor.Close())
+	assertDatabaseExpectations(t, dbMock)
+}
 
-	assert.True(t, fatal)
+func TestNewFromDBAfterEveryRetryShouldReturnConnectionError(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	defer db.Close()
+	expectedError := errors.New("connection refused")
+	dbMock.ExpectPing().WillReturnError(expectedError)
+	dbMock.ExpectPing().WillReturnError(expectedError)
+
+	_, err := NewFromDB(context.Background(), db, []string{"migrations"}, Options{
+		ConnectRetries: 1,
+		ConnectBackoff: time.Millisecond,
+	})
+
+	var connectionError ConnectionError
+	assert.ErrorAs(t, err, &connectionError)
+	assert.ErrorIs(t, err, expectedError)
 	assertDatabaseExpectations(t, dbMock)
 }
 
+func TestNewFromDBWithServerErrorShouldNotRetry(t *testing.T) {
+	db, dbMock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	defer db.Close()
+	expectedError := &pgconn.PgError{Code: "28P01", Message: "password authentication failed"}
+	dbMock.ExpectPing().WillReturnError(expectedError)
+
+	_, err := NewFromDB(context.Background(), db, []string{"migrations"}, Options{
+		ConnectRetries: 5,
+		ConnectBackoff: time.Millisecond,
+	})
+
+	assert.ErrorIs(t, err, expectedError)
+	assertDatabaseExpectations(t, dbMock)
+}
+
+func TestNewFromURLWithInvalidURLShouldReturnConnectionError(t *testing.T) {
+	_, err := NewFromURL(context.Background(), "postgres://user@localhost:port/db", []string{"migrations"}, Options{})
+
+	var connectionError ConnectionError
+	assert.ErrorAs(t, err, &connectionError)
+}
+
+func TestNewWithUnreadableCertificateShouldReturnConnectionErrorBeforeConnecting(t *testing.T) {
+	_, err := New(context.Background(), connection.DatabaseInformation{
+		Address:     "localhost",
+		SSLMode:     "verify-full",
+		SSLRootCert: "non_existent_root.crt",
+	}, []string{"migrations"}, Options{})
+
+	var connectionError ConnectionError
+	assert.ErrorAs(t, err, &connectionError)
+	var tlsError connection.TLSError
+	assert.ErrorAs(t, err, &tlsError)
+	assert.Equal(t, "sslrootcert", tlsError.Setting)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCloseWithoutConnectionShouldDoNothing(t *testing.T) {
+	processor := MigrationProcessorSQL{}
+
+	assert.Nil(t, processor.Close())
+}
+
 func assertDatabaseExpectations(t *testing.T, mock sqlmock.Sqlmock) {
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Not all expectation were met: %s", err)
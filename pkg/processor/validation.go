@@ -0,0 +1,93 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eaneto/grotto/pkg/database"
+)
+
+// ValidationError The executed scripts don't match the scripts on the
+// migration directory.
+type ValidationError struct {
+	// Versioned scripts changed after they were executed.
+	Modified []string
+	// Versioned scripts older than the latest executed version that
+	// were never executed, they are missing from the migration table.
+	Missing []string
+	// Executed scripts that are unknown to the migration directory and
+	// were not marked as deleted.
+	Unknown []string
+}
+
+func (e ValidationError) Error() string {
+	problems := []string{}
+	if len(e.Modified) > 0 {
+		problems = append(problems, "modified after execution: "+strings.Join(e.Modified, ", "))
+	}
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing from the migration table: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		problems = append(problems, "not found on the migration directory: "+strings.Join(e.Unknown, ", "))
+	}
+	return fmt.Sprintf("validation failed, %s", strings.Join(problems, "; "))
+}
+
+// validateScripts Compares the scripts on the migration directory with
+// the executed scripts and returns a ValidationError if they don't
+// match. Records without checksum, executed before checksums were
+// stored, are never considered modified and failed records are
+// considered not executed, since they will be executed again. Scripts
+// up to the baseline version are considered executed and never
+// validated.
+func validateScripts(scripts []database.SQLScript, records []database.MigrationRecord) error {
+	executed := make(map[string]database.MigrationRecord, len(records))
+	for _, record := range records {
+		if record.Success {
+			executed[record.ScriptName] = record
+		}
+	}
+
+	baseline := baselineVersion(records)
+	latest := baseline
+	for _, script := range scripts {
+		if _, ok := executed[script.Name]; ok && script.Type == database.SCRIPT_VERSIONED {
+			if latest == nil || script.Version.Compare(latest) > 0 {
+				latest = script.Version
+			}
+		}
+	}
+
+	validationError := ValidationError{}
+	onDisk := make(map[string]bool, len(scripts))
+	for _, script := range scripts {
+		onDisk[script.Name] = true
+		if script.Type != database.SCRIPT_VERSIONED || isBelowBaseline(script, baseline) {
+			continue
+		}
+		record, ok := executed[script.Name]
+		if !ok {
+			if latest != nil && script.Version.Compare(latest) < 0 {
+				validationError.Missing = append(validationError.Missing, script.Name)
+			}
+			continue
+		}
+		if record.Checksum != "" && record.Checksum != script.Checksum() {
+			validationError.Modified = append(validationError.Modified, script.Name)
+		}
+	}
+
+	for _, record := range records {
+		if !onDisk[record.ScriptName] && record.Type != database.SCRIPT_BASELINE &&
+			record.Type != database.SCRIPT_DELETED {
+			validationError.Unknown = append(validationError.Unknown, record.ScriptName)
+		}
+	}
+
+	if len(validationError.Modified) > 0 || len(validationError.Missing) > 0 ||
+		len(validationError.Unknown) > 0 {
+		return validationError
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/eaneto/grotto/pkg/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScriptsMatchingTheMigrationTableShouldNotReturnError(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "a"},
+		{Name: "V2__pending.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}, Content: "b"},
+		{Name: "R__views.sql", Type: database.SCRIPT_REPEATABLE, Content: "changed"},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Checksum: scripts[0].Checksum(), Success: true},
+		{ScriptName: "R__views.sql", Checksum: "old", Success: true},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Nil(t, err)
+}
+
+func TestValidateScriptsWithoutStoredChecksumShouldNotReturnError(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "a"},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__first.sql", Success: true},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Nil(t, err)
+}
+
+func TestValidateScriptsShouldListModifiedMissingAndUnknownScripts(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__modified.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "new"},
+		{Name: "V2__missing.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}, Content: "b"},
+		{Name: "V3__applied.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}, Content: "c"},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__modified.sql", Checksum: "old", Success: true},
+		{ScriptName: "V3__applied.sql", Checksum: scripts[2].Checksum(), Success: true},
+		{ScriptName: "V4__deleted.sql", Checksum: "d", Success: true},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Equal(t, ValidationError{
+		Modified: []string{"V1__modified.sql"},
+		Missing:  []string{"V2__missing.sql"},
+		Unknown:  []string{"V4__deleted.sql"},
+	}, err)
+	assert.Contains(t, err.Error(), "modified after execution: V1__modified.sql")
+}
+
+func TestValidateScriptsWithFailedScriptShouldConsiderItNotExecuted(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__index.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}, Content: "fixed"},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__index.sql", Checksum: "broken", Success: false},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Nil(t, err)
+}
+
+func TestValidateScriptsWithBaselineShouldConsiderScriptsUpToItExecuted(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "<< Grotto Baseline >>", Type: database.SCRIPT_BASELINE, Version: database.Version{2}, Success: true},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Nil(t, err)
+}
+
+func TestValidateScriptsWithPendingScriptOlderThanBaselineExecutedScriptShouldReturnMissing(t *testing.T) {
+	scripts := []database.SQLScript{
+		{Name: "V1__first.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{1}},
+		{Name: "V2__second.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{2}},
+		{Name: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}},
+	}
+	records := []database.MigrationRecord{
+		{ScriptName: "<< Grotto Baseline >>", Type: database.SCRIPT_BASELINE, Version: database.Version{1}, Success: true},
+		{ScriptName: "V3__third.sql", Type: database.SCRIPT_VERSIONED, Version: database.Version{3}, Checksum: scripts[2].Checksum(), Success: true},
+	}
+
+	err := validateScripts(scripts, records)
+
+	assert.Equal(t, ValidationError{Missing: []string{"V2__second.sql"}}, err)
+}
+
+func TestValidateScriptsWithDeletedScriptShouldNotReturnUnknown(t *testing.T) {
+	records := []database.MigrationRecord{
+		{ScriptName: "V1__gone.sql", Type: database.SCRIPT_DELETED, Success: true},
+	}
+
+	err := validateScripts([]database.SQLScript{}, records)
+
+	assert.Nil(t, err)
+}
@@ -14,15 +14,12 @@ stop_containers() {
 stop_containers
 start_containers
 
-# Give some time for the containers to go up
-sleep 2.5
-
 # Build grotto
 make
 
 # Test valid migration
-grotto -user user -password 123 -database test \
-    -dir test/valid_migration
+grotto migrate -user user -password 123 -database test \
+    -connect-retries 6 -dir test/valid_migration
 
 if [[ $? = 0 ]]; then
     echo "Success"
@@ -31,14 +28,19 @@ else
     exit -1
 fi
 
+# Reset the database, so the scripts of the valid migration aren't
+# reported as missing instead of the syntax error
+stop_containers
+start_containers
+
 # Test migration with syntax error
-grotto -user user -password 123 -database test \
-    -dir test/migration_with_syntax_error
+grotto migrate -user user -password 123 -database test \
+    -connect-retries 6 -dir test/migration_with_syntax_error
 
-if [[ $? = 0 ]]; then
+if [[ $? != 0 ]]; then
     echo "Success"
 else
-    echo "Failure on migration with syntax error"
+    echo "Failure on migration with syntax error, it should have failed"
     exit -1
 fi
 